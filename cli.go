@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/controllers"
+	"github.com/samrato/magicstream/database"
+	"github.com/samrato/magicstream/repository"
+)
+
+const usage = `Usage: magicstream [command] [flags]
+
+Without a command the HTTP server is started.
+
+Commands:
+  import    Import movies from a CSV, JSON or NDJSON file
+  migrate   Apply, revert or list database migrations (up, down, status)
+`
+
+// runCommand executes a CLI subcommand and returns the process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "import":
+		return importCommand(args[1:])
+	case "migrate":
+		return migrateCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// importCommand runs a bulk movie import and prints the report as JSON. It
+// exits with status 1 when any row was rejected.
+func importCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("file", "", "file to import, or - for stdin")
+	format := fs.String("format", "", "csv, json or ndjson (detected from the file when empty)")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "import: -file is required")
+		fs.Usage()
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+		if *format == "" {
+			*format = controllers.DetectImportFormat(*file, "")
+		}
+	}
+
+	client := database.Connect()
+	defer client.Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	// The import relies on the unique imdb_id index to keep deleted movies
+	// deleted, so refuse to write to a database the migrations missed
+	migrator := database.NewMigrator(database.GetDatabase(client), database.Migrations)
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import:", err)
+		return 1
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			fmt.Fprintf(os.Stderr, "import: migration %d (%s) is pending, run \"magicstream migrate up\" first\n", s.Version, s.Name)
+			return 1
+		}
+	}
+
+	repos := repository.NewMongoRepositories(client)
+	report, err := controllers.ImportMovies(ctx, repos.Movies, r, *format, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import:", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+
+	if report.Rejected > 0 {
+		return 1
+	}
+	return 0
+}
+
+// migrateCommand runs "migrate up [-to N]", "migrate down [-steps N]" or
+// "migrate status".
+func migrateCommand(args []string) int {
+	action := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	to := fs.Int("to", 0, "up: stop after this version (default: latest)")
+	steps := fs.Int("steps", 1, "down: number of migrations to revert")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	client := database.Connect()
+	defer client.Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	migrator := database.NewMigrator(database.GetDatabase(client), database.Migrations)
+
+	switch action {
+	case "up", "down":
+		var done []database.Migration
+		var err error
+		if action == "up" {
+			done, err = migrator.Up(ctx, *to)
+		} else {
+			done, err = migrator.Down(ctx, *steps)
+		}
+		for _, mig := range done {
+			fmt.Printf("%s %d: %s\n", action, mig.Version, mig.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("nothing to do")
+		}
+		return 0
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-25s  %s\n", s.Version, applied, s.Name)
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "migrate: unknown action %q (use up, down or status)\n", action)
+		return 2
+	}
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultAccountDeletionGrace is how long a deleted account is kept intact
+// before its personal data is erased, unless ACCOUNT_DELETION_GRACE_PERIOD
+// overrides it.
+const defaultAccountDeletionGrace = 30 * 24 * time.Hour
+
+func accountDeletionGrace() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultAccountDeletionGrace
+}
+
+// ========================== UPDATE PROFILE ==========================
+func UpdateProfile(users repository.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var input struct {
+			FirstName *string `json:"first_name"`
+			LastName  *string `json:"last_name"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if input.FirstName == nil && input.LastName == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update, send first_name and/or last_name"})
+			return
+		}
+
+		// Validate against the registration rules for the same fields
+		var check models.UserRegister
+		var fields []string
+		if input.FirstName != nil {
+			check.FirstName = *input.FirstName
+			fields = append(fields, "FirstName")
+		}
+		if input.LastName != nil {
+			check.LastName = *input.LastName
+			fields = append(fields, "LastName")
+		}
+		if err := userValidate.StructPartial(check, fields...); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.UpdateProfile(ctx, userID, repository.UserPatch{FirstName: input.FirstName, LastName: input.LastName})
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":          user.UserID,
+			"first_name":       user.FirstName,
+			"last_name":        user.LastName,
+			"email":            user.Email,
+			"role":             user.Role,
+			"favourite_genres": user.FavouriteGenres,
+			"email_verified":   user.EmailVerified,
+		})
+	}
+}
+
+// ========================== CHANGE PASSWORD ==========================
+func ChangePassword(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		// Accounts created through social login have no current password
+		var input struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password" validate:"required,min=6"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := userValidate.Struct(input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if user.Password == "" {
+			if !confirmRecentSignIn(ctx, c, sessions) {
+				return
+			}
+		} else if input.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "current_password is required"})
+			return
+		} else if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+
+		hashed, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		if err := users.UpdatePassword(ctx, userID, string(hashed)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+			return
+		}
+
+		// Log out every other device; this one stays signed in
+		current, _ := utils.GetSessionIdFromContext(c)
+		if err := endOtherSessions(ctx, sessions, denylist, userID, current, repository.RevokedPasswordSet); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end other sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	}
+}
+
+// ========================== DELETE ACCOUNT ==========================
+func DeleteAccount(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var input struct {
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && user.DeletedAt != nil) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if !confirmIdentity(ctx, c, sessions, user, input.Password) {
+			return
+		}
+
+		now := time.Now()
+		if err := users.SoftDelete(ctx, userID, now); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+		if err := revokeUserAccess(ctx, sessions, denylist, userID, repository.RevokedAccountDelete); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end sessions"})
+			return
+		}
+		if err := sessions.EraseUser(ctx, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Account deleted",
+			"erase_after": now.Add(accountDeletionGrace()),
+		})
+	}
+}
+
+// ========================== RE-AUTHENTICATION ==========================
+
+// reauthWindow is how recently a user without a password must have signed in
+// to confirm a sensitive change.
+const reauthWindow = 10 * time.Minute
+
+// confirmIdentity checks that the caller really is the account holder before
+// a sensitive change: with the password, or for accounts that only sign in
+// through a provider, with a fresh sign-in. It answers the request and
+// returns false when they are not.
+func confirmIdentity(ctx context.Context, c *gin.Context, sessions repository.SessionRepository, user models.User, password string) bool {
+	if user.Password == "" {
+		return confirmRecentSignIn(ctx, c, sessions)
+	}
+	if password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
+		return false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return false
+	}
+	return true
+}
+
+// confirmRecentSignIn accepts the request if the calling session was opened
+// within reauthWindow, and otherwise asks the user to sign in again.
+func confirmRecentSignIn(ctx context.Context, c *gin.Context, sessions repository.SessionRepository) bool {
+	sessionID, _ := utils.GetSessionIdFromContext(c)
+	session, err := sessions.Get(ctx, sessionID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if err != nil || time.Since(session.CreatedAt) > reauthWindow {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":           "Sign in again to confirm this change",
+			"reauth_required": true,
+		})
+		return false
+	}
+	return true
+}
+
+// ========================== ACCOUNT ERASURE ==========================
+
+// EraseDeletedAccounts anonymises every account deleted longer than the
+// grace period ago and erases its data from every repository that keeps
+// per-user data. It returns the number of accounts erased.
+func EraseDeletedAccounts(ctx context.Context, repos *repository.Repositories) (int, error) {
+	due, err := repos.Users.DeletedBefore(ctx, time.Now().Add(-accountDeletionGrace()))
+	if err != nil {
+		return 0, err
+	}
+
+	erasers := repos.UserDataErasers()
+	emailErasers := repos.UserEmailErasers()
+	erased := 0
+	for _, user := range due {
+		for _, e := range erasers {
+			if err := e.EraseUser(ctx, user.UserID); err != nil {
+				return erased, err
+			}
+		}
+		for _, e := range emailErasers {
+			if err := e.EraseEmail(ctx, user.Email); err != nil {
+				return erased, err
+			}
+		}
+		// Anonymise last, so a failed run is retried on the next pass
+		if err := repos.Users.Anonymise(ctx, user.UserID, time.Now()); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return erased, err
+		}
+		erased++
+	}
+	return erased, nil
+}
+
+// RunAccountErasure calls EraseDeletedAccounts every hour until ctx is done.
+func RunAccountErasure(ctx context.Context, repos *repository.Repositories) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		n, err := EraseDeletedAccounts(runCtx, repos)
+		cancel()
+		if err != nil {
+			log.Printf("Account erasure failed: %v", err)
+		} else if n > 0 {
+			log.Printf("Erased %d deleted accounts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
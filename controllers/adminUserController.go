@@ -0,0 +1,496 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultUserLimit   = 20
+	maxUserLimit       = 100
+	adminAuditLimit    = 20
+	maxAdminAuditLimit = 200
+)
+
+var userStatuses = map[string]bool{
+	repository.UserStatusActive:   true,
+	repository.UserStatusDisabled: true,
+	repository.UserStatusDeleted:  true,
+}
+
+// adminUserView is the admin representation of a user. It never includes the
+// password hash.
+func adminUserView(u models.User) gin.H {
+	return gin.H{
+		"user_id":           u.UserID,
+		"first_name":        u.FirstName,
+		"last_name":         u.LastName,
+		"email":             u.Email,
+		"role":              u.Role,
+		"favourite_genres":  u.FavouriteGenres,
+		"email_verified":    u.EmailVerified,
+		"email_verified_at": u.EmailVerifiedAt,
+		"disabled":          u.Disabled,
+		"disabled_at":       u.DisabledAt,
+		"deleted_at":        u.DeletedAt,
+		"created_at":        u.CreatedAt,
+		"updated_at":        u.UpdatedAt,
+	}
+}
+
+// recordAudit appends an audit entry for a change made by the calling admin,
+// noting the API key when the change was made with one.
+func recordAudit(ctx context.Context, c *gin.Context, audit repository.AuditRepository, action, targetType, targetID string, details map[string]interface{}) error {
+	actorID, _ := utils.GetUserIdFromContext(c)
+	if keyID := c.GetString("api_key_id"); keyID != "" {
+		if details == nil {
+			details = map[string]interface{}{}
+		}
+		details["api_key_id"] = keyID
+	}
+	return audit.Record(ctx, models.AuditEntry{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+		IP:         c.ClientIP(),
+		CreatedAt:  time.Now(),
+	})
+}
+
+// loadTargetUser fetches the user named in the route, writing the error
+// response itself when it cannot.
+func loadTargetUser(ctx context.Context, c *gin.Context, users repository.UserRepository) (models.User, bool) {
+	user, err := users.GetByUserID(ctx, c.Param("user_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return user, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return user, false
+	}
+	return user, true
+}
+
+// isSelf reports whether the admin is acting on their own account, which
+// would let them lock themselves out.
+func isSelf(c *gin.Context, userID string) bool {
+	actorID, _ := utils.GetUserIdFromContext(c)
+	return actorID == userID
+}
+
+// coversRole reports whether the calling user holds every permission of
+// role, so that nobody can hand out or take away more than they have.
+func coversRole(c *gin.Context, policy *utils.Policy, role string) bool {
+	actorRole, _ := utils.GetRoleFromContext(c)
+	for _, perm := range policy.PermissionsOf(role) {
+		if !policy.Allows(actorRole, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// ========================== LIST USERS ==========================
+func ListUsers(users repository.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := repository.UserQuery{Limit: defaultUserLimit}
+		q.Filter.Search = strings.TrimSpace(c.Query("q"))
+		q.Filter.Role = strings.ToUpper(strings.TrimSpace(c.Query("role")))
+		q.Filter.Status = strings.ToLower(strings.TrimSpace(c.Query("status")))
+		if q.Filter.Status != "" && !userStatuses[q.Filter.Status] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status (use active, disabled or deleted)"})
+			return
+		}
+
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			q.Limit = min(limit, maxUserLimit)
+		}
+		page := 1
+		if v := c.Query("page"); v != "" {
+			p, err := strconv.Atoi(v)
+			if err != nil || p < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+				return
+			}
+			page = p
+		}
+		q.Skip = (page - 1) * q.Limit
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		result, err := users.List(ctx, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+			return
+		}
+
+		data := make([]gin.H, len(result.Users))
+		for i, u := range result.Users {
+			data[i] = adminUserView(u)
+		}
+
+		resp := gin.H{
+			"count":       len(data),
+			"data":        data,
+			"total":       result.Total,
+			"limit":       q.Limit,
+			"page":        page,
+			"total_pages": (result.Total + int64(q.Limit) - 1) / int64(q.Limit),
+			"next":        nil,
+			"prev":        nil,
+		}
+		if int64(q.Skip+len(data)) < result.Total {
+			resp["next"] = pageLink(c, map[string]string{"page": strconv.Itoa(page + 1)})
+		}
+		if page > 1 {
+			resp["prev"] = pageLink(c, map[string]string{"page": strconv.Itoa(page - 1)})
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ========================== USER DETAIL ==========================
+func GetUserDetail(users repository.UserRepository, sessions repository.SessionRepository, audit repository.AuditRepository, attempts repository.LoginAttemptRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := loadTargetUser(ctx, c, users)
+		if !ok {
+			return
+		}
+
+		active, err := sessions.ListActive(ctx, user.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+			return
+		}
+		entries, err := audit.ListForTarget(ctx, repository.AuditTargetUser, user.UserID, adminAuditLimit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+			return
+		}
+
+		failures, err := attempts.Get(ctx, []string{repository.AccountAttemptKey(user.Email)})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login failures"})
+			return
+		}
+
+		resp := adminUserView(user)
+		resp["failed_logins"] = 0
+		if len(failures) > 0 {
+			resp["failed_logins"] = failures[0].Failures
+			resp["last_failed_login_at"] = failures[0].LastFailureAt
+		}
+		resp["active_sessions"] = len(active)
+		resp["sessions"] = active
+		resp["audit"] = entries
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ========================== USER AUDIT LOG ==========================
+func GetUserAuditLog(audit repository.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := adminAuditLimit
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = min(n, maxAdminAuditLimit)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		entries, err := audit.ListForTarget(ctx, repository.AuditTargetUser, c.Param("user_id"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"count": len(entries), "data": entries})
+	}
+}
+
+// ========================== CHANGE ROLE ==========================
+func UpdateUserRole(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository, audit repository.AuditRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Role string `json:"role"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		role := strings.ToUpper(strings.TrimSpace(input.Role))
+		if _, ok := policy.Role(role); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("role %q is not defined", role)})
+			return
+		}
+		if isSelf(c, c.Param("user_id")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot change your own role"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := loadTargetUser(ctx, c, users)
+		if !ok {
+			return
+		}
+		if !coversRole(c, policy, user.Role) || !coversRole(c, policy, role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant or revoke permissions you do not have"})
+			return
+		}
+		if user.Role == role {
+			c.JSON(http.StatusOK, adminUserView(user))
+			return
+		}
+
+		if err := users.SetRole(ctx, user.UserID, role); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+			return
+		}
+		// Tokens carry the role, so end the sessions holding the old one
+		if err := endOtherSessions(ctx, sessions, denylist, user.UserID, "", repository.RevokedRoleChange); err != nil {
+			log.Printf("Failed to end sessions of user %s after role change: %v", user.UserID, err)
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditUserRoleChanged, repository.AuditTargetUser, user.UserID, map[string]interface{}{
+			"from": user.Role,
+			"to":   role,
+		}); err != nil {
+			log.Printf("Failed to record audit entry for user %s: %v", user.UserID, err)
+		}
+
+		user.Role = role
+		c.JSON(http.StatusOK, adminUserView(user))
+	}
+}
+
+// ========================== DISABLE / ENABLE ==========================
+func DisableUser(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository, audit repository.AuditRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Reason string `json:"reason"`
+		}
+		// The body is optional
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&input); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+				return
+			}
+		}
+		if isSelf(c, c.Param("user_id")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot disable your own account"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := loadTargetUser(ctx, c, users)
+		if !ok {
+			return
+		}
+		if !coversRole(c, policy, user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot disable a user with permissions you do not have"})
+			return
+		}
+		if user.DeletedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Account is deleted"})
+			return
+		}
+		if user.Disabled {
+			c.JSON(http.StatusOK, adminUserView(user))
+			return
+		}
+
+		now := time.Now()
+		if err := users.SetDisabled(ctx, user.UserID, true, now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable account"})
+			return
+		}
+		if err := revokeUserAccess(ctx, sessions, denylist, user.UserID, repository.RevokedAccountOff); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Account disabled, but failed to end its sessions"})
+			return
+		}
+
+		var details map[string]interface{}
+		if reason := strings.TrimSpace(input.Reason); reason != "" {
+			details = map[string]interface{}{"reason": reason}
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditUserDisabled, repository.AuditTargetUser, user.UserID, details); err != nil {
+			log.Printf("Failed to record audit entry for user %s: %v", user.UserID, err)
+		}
+
+		user.Disabled, user.DisabledAt = true, &now
+		c.JSON(http.StatusOK, adminUserView(user))
+	}
+}
+
+func EnableUser(users repository.UserRepository, audit repository.AuditRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSelf(c, c.Param("user_id")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot enable your own account"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := loadTargetUser(ctx, c, users)
+		if !ok {
+			return
+		}
+		if !coversRole(c, policy, user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot enable a user with permissions you do not have"})
+			return
+		}
+		if !user.Disabled {
+			c.JSON(http.StatusOK, adminUserView(user))
+			return
+		}
+
+		if err := users.SetDisabled(ctx, user.UserID, false, time.Now()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable account"})
+			return
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditUserEnabled, repository.AuditTargetUser, user.UserID, nil); err != nil {
+			log.Printf("Failed to record audit entry for user %s: %v", user.UserID, err)
+		}
+
+		user.Disabled, user.DisabledAt = false, nil
+		c.JSON(http.StatusOK, adminUserView(user))
+	}
+}
+
+// ========================== FORCE LOGOUT ==========================
+func ForceLogoutUser(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository, audit repository.AuditRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSelf(c, c.Param("user_id")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot log out your own account here, end your sessions from /users/sessions"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := loadTargetUser(ctx, c, users)
+		if !ok {
+			return
+		}
+		if !coversRole(c, policy, user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot log out a user with permissions you do not have"})
+			return
+		}
+
+		active, err := sessions.ListActive(ctx, user.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+			return
+		}
+		if err := endOtherSessions(ctx, sessions, denylist, user.UserID, "", repository.RevokedByAdmin); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end sessions"})
+			return
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditUserLoggedOut, repository.AuditTargetUser, user.UserID, map[string]interface{}{
+			"sessions": len(active),
+		}); err != nil {
+			log.Printf("Failed to record audit entry for user %s: %v", user.UserID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Ended %d sessions", len(active))})
+	}
+}
+
+// ========================== UNLOCK LOGIN ==========================
+// UnlockUser clears the failed login counter of the user's email address,
+// lifting any backoff or lockout. Lockouts of client IPs are not affected.
+func UnlockUser(users repository.UserRepository, attempts repository.LoginAttemptRepository, audit repository.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := loadTargetUser(ctx, c, users)
+		if !ok {
+			return
+		}
+
+		if err := attempts.Reset(ctx, repository.AccountAttemptKey(user.Email)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+			return
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditUserUnlocked, repository.AuditTargetUser, user.UserID, nil); err != nil {
+			log.Printf("Failed to record audit entry for user %s: %v", user.UserID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Login failures cleared"})
+	}
+}
+
+// ========================== RESET MFA ==========================
+// ResetUserMFA removes the user's second factor, for users who lost both
+// their authenticator and their recovery codes. Their sessions are ended.
+func ResetUserMFA(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository, audit repository.AuditRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSelf(c, c.Param("user_id")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot reset your own two-factor authentication"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := loadTargetUser(ctx, c, users)
+		if !ok {
+			return
+		}
+		if !coversRole(c, policy, user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot reset a user with permissions you do not have"})
+			return
+		}
+		if user.MFA == nil {
+			c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication is not set up"})
+			return
+		}
+
+		if err := users.SetMFA(ctx, user.UserID, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+			return
+		}
+		if err := endOtherSessions(ctx, sessions, denylist, user.UserID, "", repository.RevokedMFAChange); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Two-factor authentication reset, but failed to end sessions"})
+			return
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditUserMFAReset, repository.AuditTargetUser, user.UserID, nil); err != nil {
+			log.Printf("Failed to record audit entry for user %s: %v", user.UserID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+	}
+}
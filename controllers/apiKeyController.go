@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API keys expire after 90 days unless asked otherwise, and after a year
+// at most.
+const (
+	defaultAPIKeyDays = 90
+	maxAPIKeyDays     = 365
+)
+
+// usingAPIKey reports whether the request was authenticated with an API key.
+func usingAPIKey(c *gin.Context) bool {
+	_, ok := utils.GetAPIKeyScopesFromContext(c)
+	return ok
+}
+
+// canManageKeysOf reports whether the caller may see and revoke the keys of
+// ownerID: their own, and those of users whose role has no permission the
+// caller lacks. Keys of users that no longer exist are open to everyone.
+func canManageKeysOf(ctx context.Context, c *gin.Context, users repository.UserRepository, policy *utils.Policy, ownerID string) (bool, error) {
+	if isSelf(c, ownerID) {
+		return true, nil
+	}
+	owner, err := users.GetByUserID(ctx, ownerID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return coversRole(c, policy, owner.Role), nil
+}
+
+// ========================== CREATE API KEY ==========================
+// CreateAPIKey issues a key that acts as the calling admin, limited to the
+// requested scopes. The key is in the response only; just its hash is kept.
+func CreateAPIKey(apiKeys repository.APIKeyRepository, audit repository.AuditRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// A leaked key must not be able to mint more keys
+		if usingAPIKey(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot create API keys"})
+			return
+		}
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		role, _ := utils.GetRoleFromContext(c)
+
+		var input struct {
+			Name          string   `json:"name" validate:"required,min=1,max=100"`
+			Scopes        []string `json:"scopes" validate:"required,min=1"`
+			ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		input.Name = strings.TrimSpace(input.Name)
+		if err := userValidate.Struct(input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		scopes, err := utils.NormalizePermissions(input.Scopes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, perm := range utils.Permissions {
+			if utils.ScopesGrant(scopes, perm) && !policy.Allows(role, perm) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You cannot give a key permissions you do not have", "permission": perm})
+				return
+			}
+		}
+		days := input.ExpiresInDays
+		if days == 0 {
+			days = defaultAPIKeyDays
+		}
+
+		raw, hash, err := utils.GenerateAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+			return
+		}
+		now := time.Now()
+		key := models.APIKey{
+			KeyID:     utils.GenerateID(),
+			Name:      input.Name,
+			Prefix:    raw[:len(utils.APIKeyPrefix)+8],
+			KeyHash:   hash,
+			UserID:    userID,
+			Scopes:    scopes,
+			MFA:       policy.MFARequired(role),
+			CreatedAt: now,
+			ExpiresAt: now.AddDate(0, 0, days),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := apiKeys.Create(ctx, key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save API key"})
+			return
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditAPIKeyCreated, repository.AuditTargetAPIKey, key.KeyID, map[string]interface{}{
+			"name":       key.Name,
+			"scopes":     key.Scopes,
+			"expires_at": key.ExpiresAt,
+		}); err != nil {
+			log.Printf("Failed to record audit entry for API key %s: %v", key.KeyID, err)
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"api_key": key,
+			"key":     raw,
+			"message": "Store this key now, it will not be shown again",
+		})
+	}
+}
+
+// ========================== LIST API KEYS ==========================
+// ListAPIKeys lists the keys the caller may manage, optionally only those of
+// user_id.
+func ListAPIKeys(apiKeys repository.APIKeyRepository, users repository.UserRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		all, err := apiKeys.List(ctx, c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+			return
+		}
+
+		keys := make([]models.APIKey, 0, len(all))
+		allowed := map[string]bool{}
+		for _, key := range all {
+			ok, checked := allowed[key.UserID]
+			if !checked {
+				if ok, err = canManageKeysOf(ctx, c, users, policy, key.UserID); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+					return
+				}
+				allowed[key.UserID] = ok
+			}
+			if ok {
+				keys = append(keys, key)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"data": keys, "count": len(keys)})
+	}
+}
+
+// ========================== REVOKE API KEY ==========================
+func RevokeAPIKey(apiKeys repository.APIKeyRepository, users repository.UserRepository, audit repository.AuditRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyID := c.Param("key_id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		key, err := apiKeys.Get(ctx, keyID)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		ok, err := canManageKeysOf(ctx, c, users, policy, key.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot revoke a key of a user with permissions you do not have"})
+			return
+		}
+
+		if err := apiKeys.Revoke(ctx, keyID, time.Now()); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditAPIKeyRevoked, repository.AuditTargetAPIKey, keyID, map[string]interface{}{
+			"owner_id": key.UserID,
+		}); err != nil {
+			log.Printf("Failed to record audit entry for API key %s: %v", keyID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+	}
+}
@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushEvery is how many documents are written between flushes.
+const exportFlushEvery = 500
+
+// exportEmit writes one exported document together with its CSV record.
+type exportEmit func(doc interface{}, record []string) error
+
+// exportSpec describes how one collection is exported. stream must pass every
+// document to emit as it is read from storage.
+type exportSpec struct {
+	header []string
+	stream func(ctx context.Context, repos *repository.Repositories, filter repository.MovieFilter, emit exportEmit) error
+}
+
+var exportSpecs = map[string]exportSpec{
+	"movies": {
+		header: movieCSVHeader,
+		stream: func(ctx context.Context, repos *repository.Repositories, filter repository.MovieFilter, emit exportEmit) error {
+			return repos.Movies.Each(ctx, filter, func(m models.Movie) error {
+				return emit(m, movieToCSV(m))
+			})
+		},
+	},
+	"genres": {
+		header: []string{"genre_id", "genre_name"},
+		stream: func(ctx context.Context, repos *repository.Repositories, _ repository.MovieFilter, emit exportEmit) error {
+			return repos.Genres.Each(ctx, func(g models.Genre) error {
+				return emit(g, []string{strconv.Itoa(g.GenreID), g.GenreName})
+			})
+		},
+	},
+	"rankings": {
+		header: []string{"ranking_value", "ranking_name"},
+		stream: func(ctx context.Context, repos *repository.Repositories, _ repository.MovieFilter, emit exportEmit) error {
+			return repos.Rankings.Each(ctx, func(r models.Ranking) error {
+				return emit(r, []string{strconv.Itoa(r.RankingValue), r.RankingName})
+			})
+		},
+	},
+}
+
+// ========================== EXPORT ==========================
+
+// ExportCollection streams a whole collection as JSON, NDJSON or CSV,
+// optionally gzipped. Documents are written as they are read from storage,
+// so memory use does not grow with the collection. Movie exports accept the
+// same filters as GET /movies.
+func ExportCollection(repos *repository.Repositories) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("collection")
+		spec, ok := exportSpecs[name]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown collection, use movies, genres or rankings"})
+			return
+		}
+
+		format := c.DefaultQuery("format", FormatNDJSON)
+		if format != FormatJSON && format != FormatNDJSON && format != FormatCSV {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, ndjson or csv"})
+			return
+		}
+		compress := c.Query("gzip") == "true"
+
+		var filter repository.MovieFilter
+		if name == "movies" {
+			var err error
+			if filter, err = parseMovieFilters(c); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+
+		filename := fmt.Sprintf("%s-%s.%s", name, time.Now().UTC().Format("20060102T150405Z"), format)
+		contentType := map[string]string{
+			FormatJSON:   "application/json",
+			FormatNDJSON: "application/x-ndjson",
+			FormatCSV:    "text/csv",
+		}[format]
+		if compress {
+			filename += ".gz"
+			contentType = "application/gzip"
+		}
+
+		var out io.Writer = c.Writer
+		var gz *gzip.Writer
+		var w exportWriter
+		count := 0
+
+		// Headers are sent with the first document, so a failing query can
+		// still be reported as a proper error response.
+		start := func() {
+			c.Header("Content-Type", contentType)
+			c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+			c.Status(http.StatusOK)
+			if compress {
+				gz = gzip.NewWriter(c.Writer)
+				out = gz
+			}
+			w = newExportWriter(format, out, spec.header)
+		}
+		flush := func() {
+			if gz != nil {
+				_ = gz.Flush()
+			}
+			c.Writer.Flush()
+		}
+
+		err := spec.stream(ctx, repos, filter, func(doc interface{}, record []string) error {
+			if w == nil {
+				start()
+			}
+			if err := w.write(doc, record); err != nil {
+				return err
+			}
+			if count++; count%exportFlushEvery == 0 {
+				flush()
+			}
+			return nil
+		})
+		if err != nil {
+			if w == nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + name})
+				return
+			}
+			// Headers are already sent, so the best we can do is stop.
+			log.Printf("export %s aborted after %d documents: %v", name, count, err)
+			return
+		}
+
+		if w == nil {
+			start()
+		}
+		if err := w.close(); err != nil {
+			log.Printf("export %s failed to finish: %v", name, err)
+			return
+		}
+		if gz != nil {
+			_ = gz.Close()
+		}
+		c.Writer.Flush()
+	}
+}
+
+// ========================== WRITERS ==========================
+
+type exportWriter interface {
+	write(doc interface{}, record []string) error
+	close() error
+}
+
+func newExportWriter(format string, out io.Writer, header []string) exportWriter {
+	switch format {
+	case FormatJSON:
+		return &jsonArrayWriter{out: out}
+	case FormatCSV:
+		return &csvExportWriter{w: csv.NewWriter(out), header: header}
+	default:
+		return &ndjsonWriter{enc: json.NewEncoder(out)}
+	}
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) write(doc interface{}, _ []string) error { return w.enc.Encode(doc) }
+func (w *ndjsonWriter) close() error                            { return nil }
+
+// jsonArrayWriter writes documents as the elements of a single JSON array.
+type jsonArrayWriter struct {
+	out     io.Writer
+	started bool
+}
+
+func (w *jsonArrayWriter) write(doc interface{}, _ []string) error {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if !w.started {
+		sep, w.started = "[\n", true
+	}
+	if _, err := io.WriteString(w.out, sep); err != nil {
+		return err
+	}
+	_, err = w.out.Write(raw)
+	return err
+}
+
+func (w *jsonArrayWriter) close() error {
+	end := "\n]\n"
+	if !w.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.out, end)
+	return err
+}
+
+// csvExportWriter writes the header lazily so that an empty export still
+// produces a valid file with just the header row.
+type csvExportWriter struct {
+	w             *csv.Writer
+	header        []string
+	headerWritten bool
+}
+
+func (w *csvExportWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+	return w.w.Write(w.header)
+}
+
+func (w *csvExportWriter) write(_ interface{}, record []string) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if err := w.w.Write(record); err != nil {
+		return err
+	}
+	// Flush buffered rows so they reach the response as the export streams.
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvExportWriter) close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
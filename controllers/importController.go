@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported import and export formats.
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+const (
+	maxImportSize   = 32 << 20
+	importBatchSize = 500
+)
+
+// Row statuses reported by an import.
+const (
+	ImportInserted = "inserted"
+	ImportUpdated  = "updated"
+	ImportRejected = "rejected"
+)
+
+// ImportRowResult is the outcome of a single imported row. Row is the
+// 1-based record number (the line number for NDJSON and CSV).
+type ImportRowResult struct {
+	Row    int    `json:"row"`
+	ImdbID string `json:"imdb_id,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ImportReport summarises an import. With DryRun set nothing was written and
+// the statuses describe what would have happened.
+type ImportReport struct {
+	DryRun   bool              `json:"dry_run"`
+	Format   string            `json:"format"`
+	Total    int               `json:"total"`
+	Inserted int               `json:"inserted"`
+	Updated  int               `json:"updated"`
+	Rejected int               `json:"rejected"`
+	Rows     []ImportRowResult `json:"rows"`
+}
+
+// importRow is a parsed record waiting to be validated and written.
+type importRow struct {
+	Row   int
+	Movie models.Movie
+	Err   error
+}
+
+// ========================== BULK IMPORT ==========================
+
+// ImportMoviesHandler accepts a CSV file, a JSON array or NDJSON, either as
+// the raw request body or as the "file" field of a multipart form.
+func ImportMoviesHandler(movies repository.MovieRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+		var body io.Reader = c.Request.Body
+		name := ""
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			header, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+				return
+			}
+			file, err := header.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+				return
+			}
+			defer file.Close()
+			body, name = file, header.Filename
+		}
+
+		format := c.Query("format")
+		if format == "" {
+			format = DetectImportFormat(name, c.ContentType())
+		}
+		dryRun := c.Query("dry_run") == "true"
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		report, err := ImportMovies(ctx, movies, body, format, dryRun)
+		if err != nil {
+			var parseErr *importParseError
+			if errors.As(err, &parseErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import movies"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// DetectImportFormat guesses the format from a file name or content type.
+// It returns "" when neither is conclusive, in which case ImportMovies sniffs
+// the content.
+func DetectImportFormat(filename, contentType string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	}
+	switch contentType {
+	case "text/csv":
+		return FormatCSV
+	case "application/json":
+		return FormatJSON
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return FormatNDJSON
+	}
+	return ""
+}
+
+// ImportMovies parses r, validates every row and upserts the valid ones keyed
+// on imdb_id. Rows that fail parsing or validation are rejected individually
+// and never stop the import.
+func ImportMovies(ctx context.Context, movies repository.MovieRepository, r io.Reader, format string, dryRun bool) (*ImportReport, error) {
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); bytes.Equal(bom, utf8BOM) {
+		_, _ = br.Discard(3)
+	}
+	if format == "" {
+		format = sniffImportFormat(br)
+	}
+
+	var rows []importRow
+	var err error
+	switch format {
+	case FormatCSV:
+		rows, err = parseCSVImport(br)
+	case FormatJSON:
+		rows, err = parseJSONImport(br)
+	case FormatNDJSON:
+		rows, err = parseNDJSONImport(br)
+	default:
+		return nil, &importParseError{fmt.Errorf("unsupported format %q (use csv, json or ndjson)", format)}
+	}
+	if err != nil {
+		return nil, &importParseError{err}
+	}
+
+	report := &ImportReport{DryRun: dryRun, Format: format, Total: len(rows), Rows: make([]ImportRowResult, len(rows))}
+	seen := map[string]int{}
+	var pending []int
+
+	for i, row := range rows {
+		res := &report.Rows[i]
+		res.Row, res.ImdbID = row.Row, row.Movie.ImdbID
+
+		err := row.Err
+		if err == nil {
+			err = validate.Struct(row.Movie)
+		}
+
+		switch {
+		case err != nil:
+			res.Status, res.Reason = ImportRejected, err.Error()
+		case seen[row.Movie.ImdbID] != 0:
+			res.Status = ImportRejected
+			res.Reason = fmt.Sprintf("duplicate imdb_id, first seen in row %d", seen[row.Movie.ImdbID])
+		default:
+			seen[row.Movie.ImdbID] = row.Row
+			pending = append(pending, i)
+		}
+	}
+
+	for start := 0; start < len(pending); start += importBatchSize {
+		batch := pending[start:min(start+importBatchSize, len(pending))]
+		if dryRun {
+			err = planImportBatch(ctx, movies, rows, batch, report)
+		} else {
+			err = writeImportBatch(ctx, movies, rows, batch, report)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, res := range report.Rows {
+		switch res.Status {
+		case ImportInserted:
+			report.Inserted++
+		case ImportUpdated:
+			report.Updated++
+		case ImportRejected:
+			report.Rejected++
+		}
+	}
+	return report, nil
+}
+
+// writeImportBatch upserts the rows at the given indexes and records each
+// row's outcome.
+func writeImportBatch(ctx context.Context, movies repository.MovieRepository, rows []importRow, batch []int, report *ImportReport) error {
+	batchMovies := make([]models.Movie, len(batch))
+	for i, idx := range batch {
+		batchMovies[i] = rows[idx].Movie
+	}
+
+	results, err := movies.BulkUpsert(ctx, batchMovies)
+	if err != nil {
+		return err
+	}
+
+	for i, idx := range batch {
+		res := &report.Rows[idx]
+		switch {
+		case results[i].Err != nil:
+			res.Status, res.Reason = ImportRejected, results[i].Err.Error()
+		case results[i].Inserted:
+			res.Status = ImportInserted
+		default:
+			res.Status = ImportUpdated
+		}
+	}
+	return nil
+}
+
+// planImportBatch reports whether each row would be inserted, updated or
+// rejected without writing anything.
+func planImportBatch(ctx context.Context, movies repository.MovieRepository, rows []importRow, batch []int, report *ImportReport) error {
+	ids := make([]string, len(batch))
+	for i, idx := range batch {
+		ids[i] = rows[idx].Movie.ImdbID
+	}
+
+	existing, err := movies.ExistingImdbIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range batch {
+		res := &report.Rows[idx]
+		deleted, ok := existing[res.ImdbID]
+		switch {
+		case !ok:
+			res.Status = ImportInserted
+		case deleted:
+			res.Status, res.Reason = ImportRejected, repository.ErrMovieDeleted.Error()
+		default:
+			res.Status = ImportUpdated
+		}
+	}
+	return nil
+}
+
+// ========================== PARSERS ==========================
+
+// importParseError marks errors caused by malformed input rather than by the
+// database.
+type importParseError struct{ err error }
+
+func (e *importParseError) Error() string { return e.err.Error() }
+func (e *importParseError) Unwrap() error { return e.err }
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// sniffImportFormat looks at the first non-blank byte without consuming it.
+func sniffImportFormat(br *bufio.Reader) string {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return FormatCSV
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.Discard(1)
+		case '[':
+			return FormatJSON
+		case '{':
+			return FormatNDJSON
+		default:
+			return FormatCSV
+		}
+	}
+}
+
+func parseCSVImport(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	cols, err := movieCSVColumns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var csvErr *csv.ParseError
+			if errors.As(err, &csvErr) {
+				rows = append(rows, importRow{Row: csvErr.StartLine, Err: err})
+				continue
+			}
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		movie, err := movieFromCSV(cols, record)
+		rows = append(rows, importRow{Row: line, Movie: movie, Err: err})
+	}
+	return rows, nil
+}
+
+func parseJSONImport(r io.Reader) ([]importRow, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil || tok != json.Delim('[') {
+		return nil, errors.New("expected a JSON array of movies")
+	}
+
+	var rows []importRow
+	for n := 1; dec.More(); n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON at element %d: %w", n, err)
+		}
+		var movie models.Movie
+		err := json.Unmarshal(raw, &movie)
+		rows = append(rows, importRow{Row: n, Movie: movie, Err: err})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, errors.New("unterminated JSON array")
+	}
+	return rows, nil
+}
+
+func parseNDJSONImport(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportSize)
+
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var movie models.Movie
+		err := json.Unmarshal(raw, &movie)
+		rows = append(rows, importRow{Row: line, Movie: movie, Err: err})
+	}
+	return rows, scanner.Err()
+}
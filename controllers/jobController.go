@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobRankReview classifies a movie's admin review in the background. Its
+// payload holds the imdb_id and the review.
+const JobRankReview = "rank_review"
+
+// ========================== REVIEW RANKING JOB ==========================
+
+// RankReviewJob ranks the review in the job payload and stores the ranking
+// on the movie, unless a newer review has replaced it in the meantime.
+func RankReviewJob(movies repository.MovieRepository, rankings repository.RankingRepository, classifier utils.SentimentClassifier) utils.JobHandler {
+	return func(ctx context.Context, job models.Job) (map[string]string, error) {
+		imdbID, review := job.Payload["imdb_id"], job.Payload["review"]
+
+		ranking, used, err := GetReviewRanking(ctx, review, rankings, classifier)
+		if err != nil {
+			return nil, err
+		}
+
+		result := map[string]string{
+			"imdb_id":       imdbID,
+			"ranking_name":  ranking.RankingName,
+			"ranking_value": strconv.Itoa(ranking.RankingValue),
+			"classifier":    used,
+		}
+		if err := movies.FinishRanking(ctx, imdbID, job.JobID, ranking); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				result["outcome"] = "superseded"
+				return result, nil
+			}
+			return nil, err
+		}
+		result["outcome"] = "ranked"
+		return result, nil
+	}
+}
+
+// FailReviewRanking marks the movie's ranking failed once its job is
+// dead-lettered.
+func FailReviewRanking(movies repository.MovieRepository) func(ctx context.Context, job models.Job) {
+	return func(ctx context.Context, job models.Job) {
+		err := movies.FailRanking(ctx, job.Payload["imdb_id"], job.JobID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("Failed to mark ranking of %s failed: %v", job.Payload["imdb_id"], err)
+		}
+	}
+}
+
+// ========================== JOBS ==========================
+
+func ListJobs(jobs utils.JobStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := utils.JobFilter{Type: c.Query("type"), Status: c.Query("status"), Limit: 100}
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 500 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+				return
+			}
+			filter.Limit = n
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := jobs.ListJobs(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": list, "count": len(list)})
+	}
+}
+
+func GetJob(jobs utils.JobStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		job, err := jobs.GetJob(ctx, c.Param("job_id"))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// RetryJob requeues a dead-lettered job with a fresh set of attempts.
+func RetryJob(queue *utils.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := queue.Requeue(ctx, c.Param("job_id")); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No dead job with this ID"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue job"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Job requeued"})
+	}
+}
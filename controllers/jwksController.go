@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========================== JWKS ==========================
+
+// GetJWKS publishes the public signing keys so other services can verify our
+// tokens. New keys are listed some minutes before they sign anything, so
+// clients may cache the set for a few minutes.
+func GetJWKS(keyring *utils.Keyring) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keyring.JWKS())
+	}
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Brute-force protection defaults. An email address gets a few free failed
+// logins, then has to wait 1s, 2s, 4s... between attempts, and is locked
+// once it reaches the maximum. IP addresses follow the same curve with a
+// higher allowance, since many users can share one.
+const (
+	defaultMaxLoginFailures   = 10
+	defaultMaxIPLoginFailures = 100
+	defaultLoginLockout       = 15 * time.Minute
+	loginBackoffBase          = time.Second
+	// loginFailureWindow is how long a counter survives after its last
+	// failure, so that old failures are eventually forgotten.
+	loginFailureWindow = time.Hour
+)
+
+type loginThrottleConfig struct {
+	MaxFailures   int
+	MaxIPFailures int
+	Lockout       time.Duration
+}
+
+func loginThrottleConfigFromEnv() loginThrottleConfig {
+	cfg := loginThrottleConfig{
+		MaxFailures:   defaultMaxLoginFailures,
+		MaxIPFailures: defaultMaxIPLoginFailures,
+		Lockout:       defaultLoginLockout,
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES")); err == nil && n > 0 {
+		cfg.MaxFailures = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_IP_FAILURES")); err == nil && n > 0 {
+		cfg.MaxIPFailures = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION")); err == nil && d > 0 {
+		cfg.Lockout = d
+	}
+	return cfg
+}
+
+// loginThrottle decides whether a login attempt may be checked at all.
+type loginThrottle struct {
+	attempts repository.LoginAttemptRepository
+	cfg      loginThrottleConfig
+}
+
+func newLoginThrottle(attempts repository.LoginAttemptRepository) *loginThrottle {
+	return &loginThrottle{attempts: attempts, cfg: loginThrottleConfigFromEnv()}
+}
+
+// wait returns how long the key must wait after its last failure: nothing
+// for the first third of the allowance, then a doubling delay, and the full
+// lockout once max failures are reached.
+func (t *loginThrottle) wait(failures, limit int) time.Duration {
+	free := limit / 3
+	switch {
+	case failures >= limit:
+		return t.cfg.Lockout
+	case failures <= free:
+		return 0
+	}
+	shift := failures - free - 1
+	if shift > 30 {
+		return t.cfg.Lockout
+	}
+	return min(loginBackoffBase<<shift, t.cfg.Lockout)
+}
+
+func (t *loginThrottle) limit(key string) int {
+	if strings.HasPrefix(key, "ip:") {
+		return t.cfg.MaxIPFailures
+	}
+	return t.cfg.MaxFailures
+}
+
+// reserve counts an attempt as failed against both the email and the IP
+// before the credentials are checked, so that parallel requests cannot all
+// slip through before any failure is written. It returns when they may try
+// again if the counters said to wait, or the zero time when the attempt may
+// go ahead. Refused attempts are not counted, so that they cannot keep
+// pushing a lockout back.
+func (t *loginThrottle) reserve(ctx context.Context, email, ip string) (time.Time, error) {
+	now := time.Now()
+	keys := []string{repository.AccountAttemptKey(email), repository.IPAttemptKey(ip)}
+
+	current, err := t.attempts.Get(ctx, keys)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if until := t.refusedUntil(current, now); !until.IsZero() {
+		return until, nil
+	}
+
+	expires := now.Add(max(loginFailureWindow, t.cfg.Lockout))
+	var previous []repository.LoginAttempt
+	for _, key := range keys {
+		prev, err := t.attempts.RecordFailure(ctx, key, now, expires)
+		if err != nil {
+			return time.Time{}, err
+		}
+		prev.Key = key
+		previous = append(previous, prev)
+		if limit := t.limit(key); prev.Failures+1 == limit {
+			log.Printf("Login locked for %s after %d failures", key, limit)
+		}
+	}
+
+	// Parallel requests can all pass the check above; the counters as each
+	// write found them decide which go ahead, and the rest are taken back
+	if until := t.refusedUntil(previous, now); !until.IsZero() {
+		for _, key := range keys {
+			if err := t.attempts.Forgive(ctx, key); err != nil {
+				log.Printf("Failed to forgive login attempt: %v", err)
+			}
+		}
+		return until, nil
+	}
+	return time.Time{}, nil
+}
+
+// refusedUntil returns when the latest of the counters' waits ends, or the
+// zero time if none of them is still waiting at now.
+func (t *loginThrottle) refusedUntil(attempts []repository.LoginAttempt, now time.Time) time.Time {
+	var until time.Time
+	for _, a := range attempts {
+		end := a.LastFailureAt.Add(t.wait(a.Failures, t.limit(a.Key)))
+		if end.After(now) && end.After(until) {
+			until = end
+		}
+	}
+	return until
+}
+
+// passed takes back the IP's reserved attempt once the credentials checked
+// out. The rest of the IP counter is kept, so that an attacker cannot reset
+// it by logging in to an account of their own.
+func (t *loginThrottle) passed(ctx context.Context, ip string) {
+	if err := t.attempts.Forgive(ctx, repository.IPAttemptKey(ip)); err != nil {
+		log.Printf("Failed to forgive login attempt: %v", err)
+	}
+}
+
+// succeeded clears the email's counter and takes back the IP's reserved
+// attempt.
+func (t *loginThrottle) succeeded(ctx context.Context, email, ip string) {
+	t.passed(ctx, ip)
+	if err := t.attempts.Reset(ctx, repository.AccountAttemptKey(email)); err != nil {
+		log.Printf("Failed to reset login failures: %v", err)
+	}
+}
+
+// dummyPasswordHash is compared against when the account does not exist, so
+// that unknown emails take as long to reject as wrong passwords.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("magicstream-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
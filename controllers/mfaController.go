@@ -0,0 +1,451 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultMFAIssuer = "MagicStream"
+
+func mfaIssuer() string {
+	if v := strings.TrimSpace(os.Getenv("MFA_ISSUER")); v != "" {
+		return v
+	}
+	return defaultMFAIssuer
+}
+
+func mfaEnabled(user models.User) bool {
+	return user.MFA != nil && user.MFA.Enabled
+}
+
+// respondMFAChallenge answers a login that still needs the second factor
+// with a short-lived challenge token for LoginMFA.
+func respondMFAChallenge(c *gin.Context, user models.User) {
+	mfaToken, err := utils.GenerateMFAToken(user.UserID, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"expires_in":   int(utils.MFATokenTTL.Seconds()),
+	})
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. Each TOTP code and recovery code works only once.
+func checkSecondFactor(ctx context.Context, users repository.UserRepository, user models.User, code, recoveryCode string) (bool, error) {
+	if user.MFA == nil {
+		return false, nil
+	}
+	if code != "" {
+		step, ok := utils.ValidateTOTP(user.MFA.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		err := users.UseTOTPStep(ctx, user.UserID, step)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if recoveryCode != "" {
+		err := users.UseRecoveryCode(ctx, user.UserID, utils.HashRecoveryCode(recoveryCode))
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return false, nil
+}
+
+// ========================== LOGIN SECOND STEP ==========================
+// LoginMFA exchanges the challenge token from LoginUser and a TOTP or
+// recovery code for a token pair.
+func LoginMFA(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository, attempts repository.LoginAttemptRepository) gin.HandlerFunc {
+	throttle := newLoginThrottle(attempts)
+
+	return func(c *gin.Context) {
+		var input struct {
+			MFAToken     string `json:"mfa_token"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if input.MFAToken == "" || (input.Code == "") == (input.RecoveryCode == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Send mfa_token and either code or recovery_code"})
+			return
+		}
+
+		claims, err := utils.ValidateMFAToken(input.MFAToken)
+		if err != nil || claims.ID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token, please log in again"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// A challenge token is spent once it has been exchanged
+		_, used, err := denylist.LatestRevocation(ctx, []string{repository.TokenDenyKey(claims.ID)})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		user, err := users.GetByUserID(ctx, claims.UserID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if used || err != nil || user.Disabled || user.DeletedAt != nil || !mfaEnabled(user) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token, please log in again"})
+			return
+		}
+
+		// Wrong codes count as failed logins of the account
+		ip := c.ClientIP()
+		until, err := throttle.reserve(ctx, user.Email, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !until.IsZero() {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login attempts, please try again later"})
+			return
+		}
+
+		ok, err := checkSecondFactor(ctx, users, user, input.Code, input.RecoveryCode)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+			return
+		}
+		throttle.succeeded(ctx, user.Email, ip)
+
+		now := time.Now()
+		err = denylist.Add(ctx, repository.DenylistEntry{
+			Key:       repository.TokenDenyKey(claims.ID),
+			Reason:    "mfa_challenge_used",
+			RevokedAt: now,
+			ExpiresAt: now.Add(utils.MFATokenTTL),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		pair, err := startSession(ctx, c, sessions, user, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+			return
+		}
+
+		resp := loginResponse(user, pair)
+		if input.RecoveryCode != "" {
+			resp["recovery_codes_remaining"] = len(user.MFA.RecoveryCodes) - 1
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ========================== MFA STATUS ==========================
+func GetMFAStatus(users repository.UserRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		resp := gin.H{
+			"enabled":                  mfaEnabled(user),
+			"required":                 policy.MFARequired(user.Role),
+			"session_mfa":              utils.GetMFAFromContext(c),
+			"recovery_codes_remaining": 0,
+		}
+		if mfaEnabled(user) {
+			resp["enabled_at"] = user.MFA.EnabledAt
+			resp["recovery_codes_remaining"] = len(user.MFA.RecoveryCodes)
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ========================== TOTP ENROLMENT ==========================
+// EnrollTOTP starts enrolment: it stores a new secret and returns it with
+// its otpauth:// URI, to show as a QR code. Nothing changes for the user
+// until VerifyTOTP confirms a code from the authenticator.
+func EnrollTOTP(users repository.UserRepository, sessions repository.SessionRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var input struct {
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Send your password to set up two-factor authentication"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !confirmIdentity(ctx, c, sessions, user, input.Password) {
+			return
+		}
+		if mfaEnabled(user) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		if err := users.SetMFA(ctx, userID, &models.UserMFA{Secret: secret}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrolment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TOTPProvisioningURI(mfaIssuer(), user.Email, secret),
+		})
+	}
+}
+
+// VerifyTOTP completes enrolment with a code from the authenticator, turns
+// two-factor authentication on and returns the recovery codes, which are
+// never shown again.
+func VerifyTOTP(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		sessionID, _ := utils.GetSessionIdFromContext(c)
+
+		var input struct {
+			Code string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil || input.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Send the code shown by your authenticator app"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if mfaEnabled(user) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		if user.MFA == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrolment first"})
+			return
+		}
+
+		step, ok := utils.ValidateTOTP(user.MFA.Secret, input.Code, time.Now())
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+			return
+		}
+
+		codes, hashes, err := utils.GenerateRecoveryCodes()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+		now := time.Now()
+		err = users.SetMFA(ctx, userID, &models.UserMFA{
+			Secret:        user.MFA.Secret,
+			Enabled:       true,
+			EnabledAt:     &now,
+			RecoveryCodes: hashes,
+			LastUsedStep:  step,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+			return
+		}
+
+		// Sessions elsewhere were opened without the second factor
+		if err := endOtherSessions(ctx, sessions, denylist, userID, sessionID, repository.RevokedMFAChange); err != nil {
+			log.Printf("Failed to end other sessions of user %s: %v", userID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Two-factor authentication enabled, log in again to use it on this device",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// ========================== DISABLE TOTP ==========================
+func DisableTOTP(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		sessionID, _ := utils.GetSessionIdFromContext(c)
+
+		var input struct {
+			Password     string `json:"password"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Send your password and a code or recovery code"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !mfaEnabled(user) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+		if policy.MFARequired(user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+			return
+		}
+		if !confirmIdentity(ctx, c, sessions, user, input.Password) {
+			return
+		}
+		ok, err := checkSecondFactor(ctx, users, user, input.Code, input.RecoveryCode)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+			return
+		}
+
+		if err := users.SetMFA(ctx, userID, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+			return
+		}
+		if err := endOtherSessions(ctx, sessions, denylist, userID, sessionID, repository.RevokedMFAChange); err != nil {
+			log.Printf("Failed to end other sessions of user %s: %v", userID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	}
+}
+
+// ========================== RECOVERY CODES ==========================
+// RegenerateRecoveryCodes replaces every recovery code, for users who used
+// or lost theirs. It needs a current TOTP code.
+func RegenerateRecoveryCodes(users repository.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var input struct {
+			Code string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil || input.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Send the code shown by your authenticator app"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !mfaEnabled(user) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+		ok, err := checkSecondFactor(ctx, users, user, input.Code, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+			return
+		}
+
+		// Re-read so that the step just used is kept
+		user, err = users.GetByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		codes, hashes, err := utils.GenerateRecoveryCodes()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+		mfa := *user.MFA
+		mfa.RecoveryCodes = hashes
+		if err := users.SetMFA(ctx, userID, &mfa); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recovery codes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
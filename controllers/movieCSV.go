@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// movieCSVHeader is the column layout used by CSV imports and exports.
+// Genres are written as "id:name" pairs separated by "|".
+var movieCSVHeader = []string{
+	"imdb_id", "title", "poster_path", "youtube_id", "genres",
+	"admin_review", "ranking_value", "ranking_name",
+}
+
+// requiredMovieCSVColumns must be present in an imported CSV header.
+var requiredMovieCSVColumns = []string{"imdb_id", "title", "poster_path", "youtube_id", "genres"}
+
+func movieToCSV(m models.Movie) []string {
+	return []string{
+		m.ImdbID,
+		m.Title,
+		m.PosterPath,
+		m.YouTubeID,
+		formatCSVGenres(m.Genres),
+		m.AdminReview,
+		strconv.Itoa(m.Ranking.RankingValue),
+		m.Ranking.RankingName,
+	}
+}
+
+// movieCSVColumns maps column names to their index in header and checks that
+// the required columns exist.
+func movieCSVColumns(header []string) (map[string]int, error) {
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredMovieCSVColumns {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("missing CSV column %q", name)
+		}
+	}
+	return cols, nil
+}
+
+func movieFromCSV(cols map[string]int, record []string) (models.Movie, error) {
+	get := func(name string) string {
+		if i, ok := cols[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	genres, err := parseCSVGenres(get("genres"))
+	if err != nil {
+		return models.Movie{}, err
+	}
+
+	movie := models.Movie{
+		ImdbID:      get("imdb_id"),
+		Title:       get("title"),
+		PosterPath:  get("poster_path"),
+		YouTubeID:   get("youtube_id"),
+		Genres:      genres,
+		AdminReview: get("admin_review"),
+		Ranking:     models.Ranking{RankingName: get("ranking_name")},
+	}
+	if v := get("ranking_value"); v != "" {
+		if movie.Ranking.RankingValue, err = strconv.Atoi(v); err != nil {
+			return models.Movie{}, fmt.Errorf("invalid ranking_value %q", v)
+		}
+	}
+	return movie, nil
+}
+
+func formatCSVGenres(genres []models.Genre) string {
+	parts := make([]string, len(genres))
+	for i, g := range genres {
+		parts[i] = strconv.Itoa(g.GenreID) + ":" + g.GenreName
+	}
+	return strings.Join(parts, "|")
+}
+
+func parseCSVGenres(s string) ([]models.Genre, error) {
+	genres := []models.Genre{}
+	for _, part := range strings.Split(s, "|") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, name, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid genre %q, expected id:name", part)
+		}
+		genreID, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			return nil, fmt.Errorf("invalid genre id in %q", part)
+		}
+		genres = append(genres, models.Genre{GenreID: genreID, GenreName: strings.TrimSpace(name)})
+	}
+	return genres, nil
+}
@@ -2,54 +2,97 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/samrato/magicstream/database"
 	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
 	"github.com/samrato/magicstream/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"github.com/joho/godotenv"
-	"github.com/tmc/langchaingo/llms/openai"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var validate = validator.New()
 
 // ========================== MOVIES ==========================
 
-func GetMovies(client *mongo.Client) gin.HandlerFunc {
+func GetMovies(movies repository.MovieRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		q, err := parseMovieQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "movies")
-		cursor, err := collection.Find(ctx, bson.M{})
+		page, err := movies.List(ctx, q.MovieQuery)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch movies"})
 			return
 		}
-		defer cursor.Close(ctx)
+		data := page.Movies
+
+		var hasNext, hasPrev bool
+		switch {
+		case q.Cursor == nil:
+			hasNext, hasPrev = page.HasMore, q.Page > 1
+		case q.Cursor.Before:
+			hasNext, hasPrev = true, page.HasMore
+		default:
+			hasNext, hasPrev = page.HasMore, true
+		}
 
-		var movies []models.Movie
-		if err := cursor.All(ctx, &movies); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode movies"})
-			return
+		resp := gin.H{
+			"count": len(data),
+			"data":  data,
+			"total": page.Total,
+			"limit": q.Limit,
+			"next":  nil,
+			"prev":  nil,
+		}
+		if q.Cursor == nil {
+			resp["page"] = q.Page
+			resp["total_pages"] = (page.Total + int64(q.Limit) - 1) / int64(q.Limit)
+			if hasNext {
+				resp["next"] = pageLink(c, map[string]string{"page": strconv.Itoa(q.Page + 1)})
+			}
+			if hasPrev {
+				resp["prev"] = pageLink(c, map[string]string{"page": strconv.Itoa(q.Page - 1)})
+			}
 		}
 
-		c.JSON(http.StatusOK, gin.H{"count": len(movies), "data": movies})
+		if len(data) > 0 {
+			if hasNext {
+				next := cursorFor(q, data[len(data)-1], false)
+				resp["next_cursor"] = next
+				if q.Cursor != nil {
+					resp["next"] = pageLink(c, map[string]string{"cursor": next, "page": ""})
+				}
+			}
+			if hasPrev {
+				prev := cursorFor(q, data[0], true)
+				resp["prev_cursor"] = prev
+				if q.Cursor != nil {
+					resp["prev"] = pageLink(c, map[string]string{"cursor": prev, "page": ""})
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
-func GetMovie(client *mongo.Client) gin.HandlerFunc {
+func GetMovie(movies repository.MovieRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		imdbID := c.Param("imdb_id")
 		if imdbID == "" {
@@ -60,12 +103,9 @@ func GetMovie(client *mongo.Client) gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "movies")
-		var movie models.Movie
-		err := collection.FindOne(ctx, bson.M{"imdb_id": imdbID}).Decode(&movie)
-
+		movie, err := movies.Get(ctx, imdbID)
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
+			if errors.Is(err, repository.ErrNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
 				return
 			}
@@ -77,7 +117,7 @@ func GetMovie(client *mongo.Client) gin.HandlerFunc {
 	}
 }
 
-func AddMovie(client *mongo.Client) gin.HandlerFunc {
+func AddMovie(movies repository.MovieRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var movie models.Movie
 		if err := c.ShouldBindJSON(&movie); err != nil {
@@ -89,24 +129,42 @@ func AddMovie(client *mongo.Client) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		// Only background ranking jobs set these
+		movie.RankingStatus, movie.RankingJobID = "", ""
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "movies")
-		result, err := collection.InsertOne(ctx, movie)
+		created, err := movies.Create(ctx, movie)
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A movie with this imdb_id already exists"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add movie"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"inserted_id": result.InsertedID})
+		c.JSON(http.StatusCreated, gin.H{"inserted_id": created.ID})
 	}
 }
 
-// ========================== ADMIN REVIEW ==========================
+// ========================== ADMIN MOVIE MANAGEMENT ==========================
+
+// patchableMovieFields maps the JSON fields PATCH accepts to the struct
+// fields whose validate tags apply to them.
+var patchableMovieFields = map[string]string{
+	"title":       "Title",
+	"poster_path": "PosterPath",
+	"youtube_id":  "YouTubeID",
+	"genres":      "Genres",
+}
 
-func AdminReviewUpdate(client *mongo.Client) gin.HandlerFunc {
+// defaultMovieRetention is how long soft-deleted movies are kept before a
+// purge removes them, unless MOVIE_RETENTION_PERIOD overrides it.
+const defaultMovieRetention = 30 * 24 * time.Hour
+
+func UpdateMovie(movies repository.MovieRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		imdbID := c.Param("imdb_id")
 		if imdbID == "" {
@@ -114,108 +172,323 @@ func AdminReviewUpdate(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			AdminReview string `json:"admin_review"`
+		body, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
 		}
-		if err := c.ShouldBindJSON(&req); err != nil {
+
+		var present map[string]json.RawMessage
+		var movie models.Movie
+		if err := json.Unmarshal(body, &present); err != nil || json.Unmarshal(body, &movie) != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 			return
 		}
+		if len(present) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+			return
+		}
+
+		var fields []string
+		for key := range present {
+			field, ok := patchableMovieFields[key]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Field %q cannot be updated", key)})
+				return
+			}
+			fields = append(fields, field)
+		}
+
+		// StructPartial does not dive into slices, so genres are checked one by one.
+		if err := validate.StructPartial(movie, fields...); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var patch repository.MoviePatch
+		for key := range present {
+			switch key {
+			case "title":
+				patch.Title = &movie.Title
+			case "poster_path":
+				patch.PosterPath = &movie.PosterPath
+			case "youtube_id":
+				patch.YouTubeID = &movie.YouTubeID
+			case "genres":
+				for _, g := range movie.Genres {
+					if err := validate.Struct(g); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+						return
+					}
+				}
+				patch.Genres = &movie.Genres
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
 
-		sentiment, rankVal, err := GetReviewRanking(req.AdminReview, client, c)
+		updated, err := movies.Update(ctx, imdbID, patch)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update movie"})
 			return
 		}
 
-		update := bson.M{
-			"$set": bson.M{
-				"admin_review": req.AdminReview,
-				"ranking": bson.M{
-					"ranking_name":  sentiment,
-					"ranking_value": rankVal,
-				},
-			},
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// DeleteMovie soft-deletes a movie. It disappears from every listing but can
+// be restored until a purge removes it after the retention period.
+func DeleteMovie(movies repository.MovieRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		imdbID := c.Param("imdb_id")
+		if imdbID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "imdb_id required"})
+			return
+		}
+
+		retention, err := movieRetention()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "movies")
-		res, err := collection.UpdateOne(ctx, bson.M{"imdb_id": imdbID}, update)
-		if err != nil || res.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+		now := time.Now()
+		if err := movies.SoftDelete(ctx, imdbID, now); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete movie"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"admin_review": req.AdminReview, "ranking": sentiment})
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Movie deleted",
+			"imdb_id":     imdbID,
+			"deleted_at":  now,
+			"purge_after": now.Add(retention),
+		})
 	}
 }
 
-// ========================== AI RANKING ==========================
+func RestoreMovie(movies repository.MovieRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		imdbID := c.Param("imdb_id")
+		if imdbID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "imdb_id required"})
+			return
+		}
 
-func GetReviewRanking(review string, client *mongo.Client, c *gin.Context) (string, int, error) {
-	rankings, err := GetRankings(client)
-	if err != nil {
-		return "", 0, err
-	}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
 
-	var names []string
-	for _, r := range rankings {
-		if r.RankingValue != 999 {
-			names = append(names, r.RankingName)
+		if err := movies.Restore(ctx, imdbID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Deleted movie not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore movie"})
+			return
 		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Movie restored", "imdb_id": imdbID})
 	}
+}
+
+// PurgeMovies permanently removes movies that were soft-deleted longer ago
+// than the retention period. The older_than query parameter (a Go duration
+// such as "720h") overrides MOVIE_RETENTION_PERIOD for a single run.
+func PurgeMovies(movies repository.MovieRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		retention, err := movieRetention()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if v := c.Query("older_than"); v != "" {
+			retention, err = time.ParseDuration(v)
+			if err != nil || retention < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "older_than must be a positive duration, e.g. 720h"})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		cutoff := time.Now().Add(-retention)
+		purged, err := movies.Purge(ctx, cutoff)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge movies"})
+			return
+		}
 
-	_ = godotenv.Load(".env")
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return "", 0, errors.New("OPENAI_API_KEY not set")
+		c.JSON(http.StatusOK, gin.H{"purged": purged, "deleted_before": cutoff})
 	}
+}
 
-	llm, err := openai.New(openai.WithToken(apiKey))
-	if err != nil {
-		return "", 0, err
+func movieRetention() (time.Duration, error) {
+	v := utils.GetEnv("MOVIE_RETENTION_PERIOD")
+	if v == "" {
+		return defaultMovieRetention, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, errors.New("MOVIE_RETENTION_PERIOD must be a positive duration")
 	}
+	return d, nil
+}
+
+// ========================== ADMIN REVIEW ==========================
+
+// AdminReviewUpdate saves the review right away and ranks it in the
+// background, answering 202 with the job to poll. With ?wait=true it ranks
+// the review before answering instead.
+func AdminReviewUpdate(movies repository.MovieRepository, rankings repository.RankingRepository, classifier utils.SentimentClassifier, queue *utils.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		imdbID := c.Param("imdb_id")
+		if imdbID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "imdb_id required"})
+			return
+		}
+
+		var req struct {
+			AdminReview string `json:"admin_review"`
+			CallbackURL string `json:"callback_url"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if req.CallbackURL != "" {
+			if err := queue.ValidateCallbackURL(req.CallbackURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if c.Query("wait") == "true" {
+			updateReviewNow(c, movies, rankings, classifier, imdbID, req.AdminReview)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Point the movie at the job before the job exists, so a worker can
+		// never pick it up and find the movie still pointing elsewhere
+		jobID := utils.GenerateID()
+		if err := movies.SetReviewPending(ctx, imdbID, req.AdminReview, jobID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+			return
+		}
+		userID, _ := utils.GetUserIdFromContext(c)
+		job, err := queue.Enqueue(ctx, models.Job{
+			JobID:       jobID,
+			Type:        JobRankReview,
+			Payload:     map[string]string{"imdb_id": imdbID, "review": req.AdminReview},
+			CallbackURL: req.CallbackURL,
+			CreatedBy:   userID,
+		})
+		if err != nil {
+			if err := movies.FailRanking(ctx, imdbID, jobID); err != nil {
+				log.Printf("Failed to mark ranking of %s failed: %v", imdbID, err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Review saved, but ranking it could not be scheduled"})
+			return
+		}
 
-	prompt := "Classify this review into one of these sentiments: " +
-		strings.Join(names, ", ") + ". Review: " + review
+		c.JSON(http.StatusAccepted, gin.H{
+			"admin_review":   req.AdminReview,
+			"ranking_status": models.RankingPending,
+			"job_id":         job.JobID,
+			"job_url":        "/admin/jobs/" + job.JobID,
+		})
+	}
+}
 
-	response, err := llm.Call(c, prompt)
+// updateReviewNow ranks the review within the request and saves both.
+func updateReviewNow(c *gin.Context, movies repository.MovieRepository, rankings repository.RankingRepository, classifier utils.SentimentClassifier, imdbID, review string) {
+	ranking, used, err := GetReviewRanking(c.Request.Context(), review, rankings, classifier)
 	if err != nil {
-		return "", 0, err
+		status := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrUnrecognizedRanking) {
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{"error": "Failed to rank review: " + err.Error(), "classifier": used})
+		return
 	}
 
-	for _, r := range rankings {
-		if r.RankingName == response {
-			return response, r.RankingValue, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := movies.SetReview(ctx, imdbID, review, ranking); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return
 	}
-	return response, 0, nil
+
+	c.JSON(http.StatusOK, gin.H{"admin_review": review, "ranking": ranking.RankingName, "classifier": used})
 }
 
-func GetRankings(client *mongo.Client) ([]models.Ranking, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// ========================== AI RANKING ==========================
+
+// GetReviewRanking asks the classifier which ranking fits the review. It
+// returns the ranking and the name of the classifier that chose it.
+func GetReviewRanking(ctx context.Context, review string, rankingRepo repository.RankingRepository, classifier utils.SentimentClassifier) (models.Ranking, string, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	collection := database.GetCollection(client, "rankings")
-	cursor, err := collection.Find(ctx, bson.M{})
+	rankings, err := rankingRepo.List(dbCtx)
 	if err != nil {
-		return nil, err
+		return models.Ranking{}, "", err
 	}
-	defer cursor.Close(ctx)
 
-	var rankings []models.Ranking
-	if err := cursor.All(ctx, &rankings); err != nil {
-		return nil, err
+	// Classifiers expect the labels ordered from best to worst
+	sort.Slice(rankings, func(i, j int) bool { return rankings[i].RankingValue < rankings[j].RankingValue })
+	var names []string
+	for _, r := range rankings {
+		if r.RankingValue != 999 {
+			names = append(names, r.RankingName)
+		}
+	}
+
+	response, used, err := utils.ClassifyReview(ctx, classifier, review, names)
+	if err != nil {
+		return models.Ranking{}, used, err
 	}
 
-	return rankings, nil
+	// Only store rankings that exist; never a made-up name or value 0
+	name, err := utils.MatchRanking(response, names)
+	if err != nil {
+		return models.Ranking{}, used, err
+	}
+	for _, r := range rankings {
+		if r.RankingName == name {
+			return r, used, nil
+		}
+	}
+	return models.Ranking{}, used, fmt.Errorf("%w: %q", utils.ErrUnrecognizedRanking, name)
 }
 
 // ========================== RECOMMENDATIONS ==========================
 
-func GetRecommendedMovies(client *mongo.Client) gin.HandlerFunc {
+func GetRecommendedMovies(movies repository.MovieRepository, users repository.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, err := utils.GetUserIdFromContext(c)
 		if err != nil {
@@ -223,54 +496,44 @@ func GetRecommendedMovies(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
-		genres, err := GetUsersFavouriteGenres(userID, client)
+		genres, err := GetUsersFavouriteGenres(userID, users)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if len(genres) == 0 {
+			c.JSON(http.StatusOK, []models.Movie{})
+			return
+		}
 
 		limit := int64(5)
 		if v := os.Getenv("RECOMMENDED_MOVIE_LIMIT"); v != "" {
 			limit, _ = strconv.ParseInt(v, 10, 64)
 		}
 
-		opts := options.Find().SetSort(bson.M{"ranking.ranking_value": 1}).SetLimit(limit)
-		filter := bson.M{"genres.genre_name": bson.M{"$in": genres}}
-
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "movies")
-		cursor, err := collection.Find(ctx, filter, opts)
+		page, err := movies.List(ctx, repository.MovieQuery{
+			Filter: repository.MovieFilter{GenreNames: genres},
+			Sort:   repository.SortRanking,
+			Limit:  int(limit),
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
 			return
 		}
-		defer cursor.Close(ctx)
-
-		var movies []models.Movie
-		if err := cursor.All(ctx, &movies); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode recommendations"})
-			return
-		}
 
-		c.JSON(http.StatusOK, movies)
+		c.JSON(http.StatusOK, page.Movies)
 	}
 }
 
-func GetUsersFavouriteGenres(userID string, client *mongo.Client) ([]string, error) {
+func GetUsersFavouriteGenres(userID string, users repository.UserRepository) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	collection := database.GetCollection(client, "users")
-	var result struct {
-		FavouriteGenres []struct {
-			GenreName string `bson:"genre_name"`
-		} `bson:"favourite_genres"`
-	}
-
-	err := collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&result)
-	if err == mongo.ErrNoDocuments {
+	user, err := users.GetByUserID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
 		return []string{}, nil
 	}
 	if err != nil {
@@ -278,7 +541,7 @@ func GetUsersFavouriteGenres(userID string, client *mongo.Client) ([]string, err
 	}
 
 	var genres []string
-	for _, g := range result.FavouriteGenres {
+	for _, g := range user.FavouriteGenres {
 		genres = append(genres, g.GenreName)
 	}
 
@@ -287,24 +550,16 @@ func GetUsersFavouriteGenres(userID string, client *mongo.Client) ([]string, err
 
 // ========================== GENRES ==========================
 
-func GetGenres(client *mongo.Client) gin.HandlerFunc {
+func GetGenres(genreRepo repository.GenreRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "genres")
-		cursor, err := collection.Find(ctx, bson.M{})
+		genres, err := genreRepo.List(ctx)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch genres"})
 			return
 		}
-		defer cursor.Close(ctx)
-
-		var genres []models.Genre
-		if err := cursor.All(ctx, &genres); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode genres"})
-			return
-		}
 
 		c.JSON(http.StatusOK, genres)
 	}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultMovieLimit = 20
+	maxMovieLimit     = 100
+)
+
+var movieSortKeys = map[string]bool{
+	repository.SortTitle:   true,
+	repository.SortRanking: true,
+	repository.SortCreated: true,
+}
+
+// movieQuery holds the filters, sorting and pagination of a movie listing.
+type movieQuery struct {
+	repository.MovieQuery
+	Page int
+}
+
+// movieCursor is the wire form of a repository.MovieCursor. It also records
+// the sort order so that a cursor cannot be replayed against another one.
+type movieCursor struct {
+	Sort    string `json:"s"`
+	Desc    bool   `json:"d,omitempty"`
+	Before  bool   `json:"b,omitempty"`
+	Title   string `json:"t,omitempty"`
+	Ranking int    `json:"r,omitempty"`
+	ID      string `json:"id"`
+}
+
+// ========================== PARSING ==========================
+
+// parseMovieFilters reads the filter parameters shared by every movie listing.
+func parseMovieFilters(c *gin.Context) (repository.MovieFilter, error) {
+	var f repository.MovieFilter
+	f.GenreNames = splitList(c.Query("genre"))
+	for _, raw := range splitList(c.Query("genre_id")) {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return f, fmt.Errorf("invalid genre_id %q", raw)
+		}
+		f.GenreIDs = append(f.GenreIDs, id)
+	}
+
+	var err error
+	if f.RankingMin, err = optionalInt(c, "ranking_min"); err != nil {
+		return f, err
+	}
+	if f.RankingMax, err = optionalInt(c, "ranking_max"); err != nil {
+		return f, err
+	}
+	if f.RankingMin != nil && f.RankingMax != nil && *f.RankingMin > *f.RankingMax {
+		return f, errors.New("ranking_min must not be greater than ranking_max")
+	}
+
+	f.TitlePrefix = strings.TrimSpace(c.Query("title"))
+	return f, nil
+}
+
+// parseMovieQuery reads filters, sorting and pagination from the request.
+func parseMovieQuery(c *gin.Context) (movieQuery, error) {
+	q := movieQuery{Page: 1}
+	q.Limit = defaultMovieLimit
+	q.Sort = repository.SortCreated
+
+	filter, err := parseMovieFilters(c)
+	if err != nil {
+		return q, err
+	}
+	q.Filter = filter
+
+	if v := c.Query("sort"); v != "" {
+		if !movieSortKeys[v] {
+			return q, fmt.Errorf("invalid sort %q (use title, ranking or created)", v)
+		}
+		q.Sort = v
+	}
+	switch strings.ToLower(c.DefaultQuery("order", "asc")) {
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("invalid order (use asc or desc)")
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		q.Limit = min(limit, maxMovieLimit)
+	}
+	if v := c.Query("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return q, errors.New("page must be a positive integer")
+		}
+		q.Page = page
+	}
+	q.Skip = (q.Page - 1) * q.Limit
+
+	if v := c.Query("cursor"); v != "" {
+		cur, err := decodeMovieCursor(v)
+		if err != nil {
+			return q, err
+		}
+		if cur.Sort != q.Sort || cur.Desc != q.Desc {
+			return q, errors.New("cursor does not match the requested sort order")
+		}
+		id, err := primitive.ObjectIDFromHex(cur.ID)
+		if err != nil {
+			return q, errors.New("invalid cursor")
+		}
+		q.Cursor = &repository.MovieCursor{Before: cur.Before, Title: cur.Title, Ranking: cur.Ranking, ID: id}
+	}
+
+	return q, nil
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func optionalInt(c *gin.Context, key string) (*int, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", key)
+	}
+	return &n, nil
+}
+
+// ========================== CURSORS & LINKS ==========================
+
+func cursorFor(q movieQuery, m models.Movie, before bool) string {
+	return encodeMovieCursor(movieCursor{
+		Sort:    q.Sort,
+		Desc:    q.Desc,
+		Before:  before,
+		Title:   m.Title,
+		Ranking: m.Ranking.RankingValue,
+		ID:      m.ID.Hex(),
+	})
+}
+
+func encodeMovieCursor(cur movieCursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeMovieCursor(s string) (*movieCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cur movieCursor
+	if err := json.Unmarshal(raw, &cur); err != nil || cur.ID == "" {
+		return nil, errors.New("invalid cursor")
+	}
+	if !movieSortKeys[cur.Sort] {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cur, nil
+}
+
+// pageLink returns the current request URL with the given query overrides.
+// An empty value removes the parameter.
+func pageLink(c *gin.Context, overrides map[string]string) string {
+	u := url.URL{Path: c.Request.URL.Path}
+	values := c.Request.URL.Query()
+	for k, v := range overrides {
+		if v == "" {
+			values.Del(k)
+		} else {
+			values.Set(k, v)
+		}
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
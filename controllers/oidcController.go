@@ -0,0 +1,388 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcFlowTTL is how long the user has to finish signing in at the provider.
+const oidcFlowTTL = 10 * time.Minute
+
+// loadProvider returns the provider named in the URL, or writes a 404.
+func loadProvider(c *gin.Context, providers utils.OIDCProviders) (*utils.OIDCProvider, bool) {
+	provider := providers.Get(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return nil, false
+	}
+	return provider, true
+}
+
+// beginOIDCFlow stores a new flow and writes the provider URL to send the
+// user to, with the state the frontend must check on its callback page.
+func beginOIDCFlow(ctx context.Context, c *gin.Context, flows repository.OIDCFlowRepository, provider *utils.OIDCProvider, linkUserID string) {
+	state, stateHash, err := utils.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	nonce, _, err := utils.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	verifier, challenge, err := utils.GeneratePKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		log.Printf("Identity provider %s is unavailable: %v", provider.Name(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	now := time.Now()
+	err = flows.Create(ctx, models.OIDCFlow{
+		StateHash:    stateHash,
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(oidcFlowTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authURL,
+		"state":             state,
+		"expires_in":        int(oidcFlowTTL.Seconds()),
+	})
+}
+
+// oidcUserNames picks first and last names for a new account from the
+// provider's claims, falling back to the email's local part.
+func oidcUserNames(id utils.OIDCIdentity) (string, string) {
+	first, last := strings.TrimSpace(id.GivenName), strings.TrimSpace(id.FamilyName)
+	if first == "" && last == "" {
+		parts := strings.Fields(id.Name)
+		if len(parts) > 0 {
+			first, last = parts[0], strings.Join(parts[1:], " ")
+		}
+	}
+	if first == "" {
+		first, _, _ = strings.Cut(id.Email, "@")
+	}
+	return first, last
+}
+
+// ========================== PROVIDERS ==========================
+func ListOIDCProviders(providers utils.OIDCProviders) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list := []gin.H{}
+		for _, p := range providers.Sorted() {
+			list = append(list, gin.H{"name": p.Name(), "display_name": p.DisplayName()})
+		}
+		c.JSON(http.StatusOK, gin.H{"providers": list})
+	}
+}
+
+// ========================== OIDC LOGIN ==========================
+// StartOIDCLogin begins an authorization code flow with PKCE for logging in
+// or signing up with an external provider.
+func StartOIDCLogin(providers utils.OIDCProviders, flows repository.OIDCFlowRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := loadProvider(c, providers)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		beginOIDCFlow(ctx, c, flows, provider, "")
+	}
+}
+
+// OIDCCallback finishes a flow with the code and state the provider sent to
+// the frontend's redirect page. A login flow logs the user in, creating the
+// account on first use; a link flow links the identity to the user who
+// started it.
+func OIDCCallback(users repository.UserRepository, identities repository.IdentityRepository, flows repository.OIDCFlowRepository, sessions repository.SessionRepository, providers utils.OIDCProviders, policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := loadProvider(c, providers)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Code  string `json:"code"`
+			State string `json:"state"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil || input.Code == "" || input.State == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Send the code and state from the provider"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		flow, err := flows.Consume(ctx, utils.HashSecret(input.State), time.Now())
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err != nil || flow.Provider != provider.Name() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in expired or was already used, please try again"})
+			return
+		}
+
+		id, err := provider.Exchange(ctx, input.Code, flow.CodeVerifier, flow.Nonce)
+		if err != nil {
+			log.Printf("Sign-in with %s failed: %v", provider.Name(), err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in with the identity provider failed"})
+			return
+		}
+
+		now := time.Now()
+		if flow.LinkUserID != "" {
+			user, err := users.GetByUserID(ctx, flow.LinkUserID)
+			if err != nil || user.DeletedAt != nil || user.Disabled {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				return
+			}
+			err = identities.Create(ctx, models.UserIdentity{
+				UserID:    user.UserID,
+				Provider:  provider.Name(),
+				Subject:   id.Subject,
+				Email:     id.Email,
+				CreatedAt: now,
+			})
+			if errors.Is(err, repository.ErrDuplicate) {
+				c.JSON(http.StatusConflict, gin.H{"error": "This provider account is already linked, or you already linked this provider"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "Account linked", "provider": provider.Name()})
+			return
+		}
+
+		var user models.User
+		created := false
+		identity, err := identities.Get(ctx, provider.Name(), id.Subject)
+		if err == nil {
+			user, err = users.GetByUserID(ctx, identity.UserID)
+			switch {
+			case errors.Is(err, repository.ErrNotFound):
+				// A link without its user is left by a sign-up that failed
+				// half way; drop it and sign up again
+				if err := identities.Delete(ctx, identity.UserID, provider.Name()); err != nil && !errors.Is(err, repository.ErrNotFound) {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+					return
+				}
+				err = repository.ErrNotFound
+			case err != nil:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			case user.DeletedAt != nil:
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in with the identity provider failed"})
+				return
+			}
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, repository.ErrNotFound):
+			// Only an email the provider verified may become an account,
+			// and never one that is registered already: linking to an
+			// existing account needs its owner to be logged in
+			if id.Email == "" || !id.EmailVerified {
+				c.JSON(http.StatusForbidden, gin.H{"error": "The identity provider did not confirm your email address"})
+				return
+			}
+			if _, err := users.GetByEmail(ctx, id.Email); err == nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists, log in and link the provider from your account"})
+				return
+			} else if !errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+
+			// Link first: should creating the user fail the link is removed
+			// again, or cleared on the next sign-in if that fails too, so
+			// no user is ever left that its provider cannot sign in to
+			userID := utils.GenerateID()
+			err = identities.Create(ctx, models.UserIdentity{
+				UserID:    userID,
+				Provider:  provider.Name(),
+				Subject:   id.Subject,
+				Email:     id.Email,
+				CreatedAt: now,
+			})
+			if errors.Is(err, repository.ErrDuplicate) {
+				c.JSON(http.StatusConflict, gin.H{"error": "This account is already being signed up, please try again"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+				return
+			}
+
+			first, last := oidcUserNames(id)
+			user, err = users.Create(ctx, models.User{
+				UserID:          userID,
+				FirstName:       first,
+				LastName:        last,
+				Email:           id.Email,
+				Role:            policy.DefaultRole(),
+				EmailVerified:   true,
+				EmailVerifiedAt: &now,
+				FavouriteGenres: []models.Genre{},
+				CreatedAt:       now,
+				UpdatedAt:       now,
+			})
+			if err != nil {
+				if err := identities.Delete(ctx, userID, provider.Name()); err != nil {
+					log.Printf("Failed to remove %s link of user %s that was never created: %v", provider.Name(), userID, err)
+				}
+				if errors.Is(err, repository.ErrDuplicate) {
+					c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists, log in and link the provider from your account"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+				return
+			}
+			created = true
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if err := identities.RecordLogin(ctx, provider.Name(), id.Subject, now); err != nil {
+			log.Printf("Failed to record %s login of user %s: %v", provider.Name(), user.UserID, err)
+		}
+		if user.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			return
+		}
+		if mfaEnabled(user) {
+			respondMFAChallenge(c, user)
+			return
+		}
+
+		pair, err := startSession(ctx, c, sessions, user, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+			return
+		}
+
+		resp := loginResponse(user, pair)
+		resp["provider"] = provider.Name()
+		if created {
+			resp["new_user"] = true
+			c.JSON(http.StatusCreated, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ========================== LINKED IDENTITIES ==========================
+func ListIdentities(identities repository.IdentityRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := identities.ListForUser(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch linked accounts"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": list, "count": len(list)})
+	}
+}
+
+// LinkIdentity begins a flow that links a provider to the logged-in user.
+func LinkIdentity(providers utils.OIDCProviders, flows repository.OIDCFlowRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		provider, ok := loadProvider(c, providers)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		beginOIDCFlow(ctx, c, flows, provider, userID)
+	}
+}
+
+// UnlinkIdentity removes a linked provider, unless it is the only way the
+// user can still log in.
+func UnlinkIdentity(users repository.UserRepository, identities repository.IdentityRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		provider := strings.ToLower(c.Param("provider"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		linked, err := identities.ListForUser(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch linked accounts"})
+			return
+		}
+		if user.Password == "" && len(linked) == 1 && linked[0].Provider == provider {
+			c.JSON(http.StatusConflict, gin.H{"error": "Set a password before unlinking your only sign-in method"})
+			return
+		}
+
+		if err := identities.Delete(ctx, userID, provider); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Provider is not linked"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Account unlinked"})
+	}
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultPasswordResetTTL      = time.Hour
+	defaultPasswordResetInterval = 2 * time.Minute
+	defaultPasswordResetIPLimit  = 20
+	// passwordResetIPWindow is how long an IP's reset requests are counted
+	// after its last one.
+	passwordResetIPWindow = time.Hour
+)
+
+// passwordResetTTL is how long a reset link stays valid, overridable with
+// PASSWORD_RESET_TTL.
+func passwordResetTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultPasswordResetTTL
+}
+
+// passwordResetInterval is the minimum time between two reset emails to the
+// same user, overridable with PASSWORD_RESET_INTERVAL.
+func passwordResetInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultPasswordResetInterval
+}
+
+// passwordResetIPLimit is how many reset requests one IP may make within
+// passwordResetIPWindow, overridable with PASSWORD_RESET_MAX_PER_IP.
+func passwordResetIPLimit() int {
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_RESET_MAX_PER_IP")); err == nil && n > 0 {
+		return n
+	}
+	return defaultPasswordResetIPLimit
+}
+
+// appLink builds a link into the frontend at APP_BASE_URL.
+func appLink(path, token string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:5173"
+	}
+	return strings.TrimRight(base, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendEmail delivers in the background so that the response time does not
+// reveal whether an email was sent.
+func sendEmail(mailer utils.Mailer, email utils.Email) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mailer.Send(ctx, email); err != nil {
+			log.Printf("Failed to send %q email: %v", email.Subject, err)
+		}
+	}()
+}
+
+// ========================== FORGOT PASSWORD ==========================
+func ForgotPassword(users repository.UserRepository, tokens repository.UserTokenRepository, attempts repository.LoginAttemptRepository, mailer utils.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" validate:"required,email"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := userValidate.Struct(input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Same answer whether or not the email is registered
+		accepted := gin.H{"message": "If that email is registered, a password reset link has been sent"}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Rate-limited requests get the same answer too, and send nothing
+		now := time.Now()
+		key := repository.PasswordResetAttemptKey(c.ClientIP())
+		prev, err := attempts.RecordFailure(ctx, key, now, now.Add(passwordResetIPWindow))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if prev.Failures >= passwordResetIPLimit() {
+			c.JSON(http.StatusAccepted, accepted)
+			return
+		}
+
+		user, err := users.GetByEmail(ctx, input.Email)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && user.DeletedAt != nil) {
+			c.JSON(http.StatusAccepted, accepted)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		last, err := tokens.Latest(ctx, user.UserID, models.TokenPurposePasswordReset)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err == nil && now.Sub(last.CreatedAt) < passwordResetInterval() {
+			c.JSON(http.StatusAccepted, accepted)
+			return
+		}
+
+		token, hash, err := utils.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		// Only the latest link works
+		if err := tokens.DeleteForUser(ctx, user.UserID, models.TokenPurposePasswordReset); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		ttl := passwordResetTTL()
+		err = tokens.Create(ctx, models.UserToken{
+			TokenHash: hash,
+			UserID:    user.UserID,
+			Purpose:   models.TokenPurposePasswordReset,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ttl),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		sendEmail(mailer, utils.Email{
+			To:      user.Email,
+			Subject: "Reset your MagicStream password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+				user.FirstName, ttl, appLink("/reset-password", token)),
+		})
+
+		c.JSON(http.StatusAccepted, accepted)
+	}
+}
+
+// ========================== RESET PASSWORD ==========================
+func ResetPassword(users repository.UserRepository, tokens repository.UserTokenRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository, attempts repository.LoginAttemptRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token    string `json:"token" validate:"required"`
+			Password string `json:"password" validate:"required,min=6"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := userValidate.Struct(input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		token, err := tokens.Consume(ctx, models.TokenPurposePasswordReset, utils.HashSecret(input.Token), time.Now())
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		err = users.UpdatePassword(ctx, token.UserID, string(hashed))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+			return
+		}
+
+		// Whoever knew the old password must not stay logged in
+		if err := endOtherSessions(ctx, sessions, denylist, token.UserID, "", repository.RevokedPasswordReset); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end existing sessions"})
+			return
+		}
+
+		// Proving access to the mailbox lifts a lockout of the account
+		if user, err := users.GetByUserID(ctx, token.UserID); err == nil {
+			if err := attempts.Reset(ctx, repository.AccountAttemptKey(user.Email)); err != nil {
+				log.Printf("Failed to reset login failures of user %s: %v", user.UserID, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in"})
+	}
+}
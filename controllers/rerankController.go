@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobRerankCatalog re-classifies the admin review of every movie. Its
+// payload holds dry_run, concurrency and rate_per_minute.
+const JobRerankCatalog = "rerank_catalog"
+
+const (
+	defaultRerankConcurrency = 2
+	maxRerankConcurrency     = 16
+	defaultRerankRate        = 60
+	maxRerankRate            = 6000
+)
+
+// rerankProgressInterval is how often a running re-rank stores its progress.
+const rerankProgressInterval = 5 * time.Second
+
+// ========================== CATALOG RE-RANKING JOB ==========================
+
+// RerankCatalogJob ranks every movie's admin review again and, unless the
+// run is a dry run, stores rankings that changed. Each movie's outcome is
+// recorded as soon as it is known, so a run that is interrupted resumes
+// where it stopped; movies that failed are tried again.
+func RerankCatalogJob(movies repository.MovieRepository, rankings repository.RankingRepository, classifier utils.SentimentClassifier, changes repository.RerankRepository, queue *utils.JobQueue) utils.JobHandler {
+	return func(ctx context.Context, job models.Job) (map[string]string, error) {
+		dryRun := job.Payload["dry_run"] == "true"
+		concurrency := payloadInt(job.Payload, "concurrency", defaultRerankConcurrency, 1, maxRerankConcurrency)
+		rate := payloadInt(job.Payload, "rate_per_minute", defaultRerankRate, 1, maxRerankRate)
+
+		previous, err := changes.List(ctx, job.JobID, repository.RerankFilter{})
+		if err != nil {
+			return nil, err
+		}
+		done := make(map[string]bool, len(previous))
+		counts := map[string]int{}
+		for _, ch := range previous {
+			if ch.Outcome != models.RerankFailed {
+				done[ch.ImdbID] = true
+				counts[ch.Outcome]++
+			}
+		}
+
+		var todo []models.Movie
+		total := 0
+		err = movies.Each(ctx, repository.MovieFilter{}, func(m models.Movie) error {
+			total++
+			if !done[m.ImdbID] {
+				todo = append(todo, m)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var mu sync.Mutex
+		progress := func() models.JobProgress {
+			mu.Lock()
+			defer mu.Unlock()
+			p := models.JobProgress{Total: total, Counts: map[string]int{}}
+			for outcome, n := range counts {
+				p.Counts[outcome] = n
+				p.Done += n
+			}
+			return p
+		}
+		report := func() {
+			if err := queue.ReportProgress(ctx, job, progress()); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to report progress of job %s: %v", job.JobID, err)
+			}
+		}
+
+		report()
+
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Hand out movies no faster than the rate limit allows
+		next := make(chan models.Movie)
+		go func() {
+			defer close(next)
+			tick := time.NewTicker(time.Minute / time.Duration(rate))
+			defer tick.Stop()
+			for i, m := range todo {
+				if i > 0 {
+					select {
+					case <-tick.C:
+					case <-runCtx.Done():
+						return
+					}
+				}
+				select {
+				case next <- m:
+				case <-runCtx.Done():
+					return
+				}
+			}
+		}()
+
+		var wg sync.WaitGroup
+		var firstErr error
+		for range concurrency {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for m := range next {
+					change := rerankMovie(runCtx, movies, rankings, classifier, m, dryRun)
+					if runCtx.Err() != nil {
+						return
+					}
+					change.RunID = job.JobID
+					if err := changes.Record(runCtx, change); err != nil {
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+						cancel()
+						return
+					}
+					mu.Lock()
+					counts[change.Outcome]++
+					mu.Unlock()
+				}
+			}()
+		}
+
+		finished := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(finished)
+		}()
+		tick := time.NewTicker(rerankProgressInterval)
+		defer tick.Stop()
+	wait:
+		for {
+			select {
+			case <-finished:
+				break wait
+			case <-tick.C:
+				report()
+			}
+		}
+
+		// Stopping early is retried later and resumes from the recorded
+		// outcomes
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report()
+
+		final := progress()
+		result := map[string]string{
+			"dry_run":     strconv.FormatBool(dryRun),
+			"total":       strconv.Itoa(final.Total),
+			"changes_url": "/admin/rerank/" + job.JobID + "/changes",
+		}
+		for _, outcome := range []string{models.RerankUnchanged, models.RerankChanged, models.RerankSkipped, models.RerankFailed} {
+			result[outcome] = strconv.Itoa(final.Counts[outcome])
+		}
+		return result, nil
+	}
+}
+
+// rerankMovie ranks the review of m again and, unless dryRun is set, stores
+// a ranking that changed.
+func rerankMovie(ctx context.Context, movies repository.MovieRepository, rankings repository.RankingRepository, classifier utils.SentimentClassifier, m models.Movie, dryRun bool) models.RerankChange {
+	change := models.RerankChange{
+		ImdbID:     m.ImdbID,
+		Title:      m.Title,
+		OldRanking: m.Ranking,
+		CreatedAt:  time.Now(),
+	}
+	switch {
+	case m.AdminReview == "":
+		change.Outcome, change.Reason = models.RerankSkipped, "no admin review"
+		return change
+	case m.RankingStatus == models.RankingPending:
+		change.Outcome, change.Reason = models.RerankSkipped, "review is being ranked"
+		return change
+	}
+
+	ranking, used, err := GetReviewRanking(ctx, m.AdminReview, rankings, classifier)
+	change.Classifier = used
+	if err != nil {
+		change.Outcome, change.Reason = models.RerankFailed, err.Error()
+		return change
+	}
+	change.NewRanking = &ranking
+	if ranking == m.Ranking {
+		change.Outcome = models.RerankUnchanged
+		return change
+	}
+	change.Outcome = models.RerankChanged
+	if dryRun {
+		return change
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := movies.Rerank(dbCtx, m.ImdbID, m.AdminReview, ranking); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			change.Outcome, change.Reason = models.RerankSkipped, "movie or review changed during the run"
+			return change
+		}
+		change.Outcome, change.Reason = models.RerankFailed, err.Error()
+		return change
+	}
+	change.Applied = true
+	return change
+}
+
+// payloadInt reads an integer from a job payload, falling back to def when
+// it is missing or out of range.
+func payloadInt(payload map[string]string, key string, def, lo, hi int) int {
+	n, err := strconv.Atoi(payload[key])
+	if err != nil || n < lo || n > hi {
+		return def
+	}
+	return n
+}
+
+// ========================== CATALOG RE-RANKING ==========================
+
+// StartRerank schedules a re-ranking of the whole catalog. Runs are dry by
+// default; only one may be queued or running at a time.
+func StartRerank(jobs utils.JobStore, queue *utils.JobQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := struct {
+			DryRun        *bool  `json:"dry_run"`
+			Concurrency   int    `json:"concurrency"`
+			RatePerMinute int    `json:"rate_per_minute"`
+			CallbackURL   string `json:"callback_url"`
+		}{}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+				return
+			}
+		}
+
+		dryRun := req.DryRun == nil || *req.DryRun
+		if req.Concurrency == 0 {
+			req.Concurrency = defaultRerankConcurrency
+		}
+		if req.Concurrency < 1 || req.Concurrency > maxRerankConcurrency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "concurrency must be between 1 and " + strconv.Itoa(maxRerankConcurrency)})
+			return
+		}
+		if req.RatePerMinute == 0 {
+			req.RatePerMinute = defaultRerankRate
+		}
+		if req.RatePerMinute < 1 || req.RatePerMinute > maxRerankRate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rate_per_minute must be between 1 and " + strconv.Itoa(maxRerankRate)})
+			return
+		}
+		if req.CallbackURL != "" {
+			if err := queue.ValidateCallbackURL(req.CallbackURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		for _, status := range []string{models.JobQueued, models.JobRunning} {
+			active, err := jobs.ListJobs(ctx, utils.JobFilter{Type: JobRerankCatalog, Status: status, Limit: 1})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check running jobs"})
+				return
+			}
+			if len(active) > 0 {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":   "A catalog re-ranking is already " + status,
+					"job_id":  active[0].JobID,
+					"job_url": "/admin/jobs/" + active[0].JobID,
+				})
+				return
+			}
+		}
+
+		userID, _ := utils.GetUserIdFromContext(c)
+		job, err := queue.Enqueue(ctx, models.Job{
+			Type: JobRerankCatalog,
+			Payload: map[string]string{
+				"dry_run":         strconv.FormatBool(dryRun),
+				"concurrency":     strconv.Itoa(req.Concurrency),
+				"rate_per_minute": strconv.Itoa(req.RatePerMinute),
+			},
+			CallbackURL: req.CallbackURL,
+			CreatedBy:   userID,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule re-ranking"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"job_id":      job.JobID,
+			"dry_run":     dryRun,
+			"job_url":     "/admin/jobs/" + job.JobID,
+			"changes_url": "/admin/rerank/" + job.JobID + "/changes",
+		})
+	}
+}
+
+// GetRerankChanges lists what a re-ranking run found, movie by movie.
+func GetRerankChanges(changes repository.RerankRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := repository.RerankFilter{Outcome: c.Query("outcome"), Limit: 100}
+		switch filter.Outcome {
+		case "", models.RerankUnchanged, models.RerankChanged, models.RerankSkipped, models.RerankFailed:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "outcome must be unchanged, changed, skipped or failed"})
+			return
+		}
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 500 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+				return
+			}
+			filter.Limit = n
+		}
+		if v := c.Query("skip"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "skip must be a non-negative number"})
+				return
+			}
+			filter.Skip = n
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := changes.List(ctx, c.Param("job_id"), filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch changes"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": list, "count": len(list)})
+	}
+}
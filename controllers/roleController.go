@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========================== LIST ROLES ==========================
+func ListRoles(policy *utils.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"roles":        policy.Roles(),
+			"permissions":  utils.Permissions,
+			"default_role": policy.DefaultRole(),
+		})
+	}
+}
+
+// ========================== SAVE ROLE ==========================
+// SaveRole creates the role named in the path or replaces its permissions.
+func SaveRole(policy *utils.Policy, audit repository.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Description string   `json:"description"`
+			Permissions []string `json:"permissions"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if input.Permissions == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "permissions is required (use [] for none)"})
+			return
+		}
+
+		role := models.Role{
+			Name:        c.Param("name"),
+			Description: strings.TrimSpace(input.Description),
+			Permissions: input.Permissions,
+		}
+		if err := utils.ValidateRole(&role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if role.Name == utils.AdminRole {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The ADMIN role always has every permission and cannot be changed"})
+			return
+		}
+
+		// Nobody may grant or take away permissions they do not have, or they
+		// could write themselves a bigger role
+		actorRole, _ := utils.GetRoleFromContext(c)
+		for _, perm := range utils.Permissions {
+			if utils.ScopesGrant(role.Permissions, perm) && !policy.Allows(actorRole, perm) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant permissions you do not have", "permission": perm})
+				return
+			}
+		}
+		if !coversRole(c, policy, role.Name) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot change a role that has permissions you do not have"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		previous, existed := policy.Role(role.Name)
+		if err := policy.Save(ctx, role); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role"})
+			return
+		}
+
+		details := map[string]interface{}{"permissions": role.Permissions}
+		if existed {
+			details["previous_permissions"] = previous.Permissions
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditRoleSaved, repository.AuditTargetRole, role.Name, details); err != nil {
+			log.Printf("Failed to record audit entry for role %s: %v", role.Name, err)
+		}
+
+		saved, _ := policy.Role(role.Name)
+		status := http.StatusOK
+		if !existed {
+			status = http.StatusCreated
+		}
+		c.JSON(status, saved)
+	}
+}
+
+// ========================== DELETE ROLE ==========================
+// DeleteRole removes a role that no user holds any more.
+func DeleteRole(policy *utils.Policy, users repository.UserRepository, audit repository.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.ToUpper(c.Param("name"))
+		if name == utils.AdminRole || name == policy.DefaultRole() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The ADMIN and default roles cannot be deleted"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		holders, err := users.List(ctx, repository.UserQuery{Filter: repository.UserFilter{Role: name}, Limit: 1})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if holders.Total > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to users", "users": holders.Total})
+			return
+		}
+
+		err = policy.Delete(ctx, name)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+			return
+		}
+		if err := recordAudit(ctx, c, audit, repository.AuditRoleDeleted, repository.AuditTargetRole, name, nil); err != nil {
+			log.Printf("Failed to record audit entry for role %s: %v", name, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+	}
+}
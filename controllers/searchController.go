@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+
+	// fuzzyScanLimit caps how many movies the typo-tolerant pass inspects,
+	// oldest first.
+	fuzzyScanLimit = 2000
+	// fuzzyMinScore is the lowest fuzzy score that still counts as a hit.
+	fuzzyMinScore = 0.5
+
+	highlightPre  = "<mark>"
+	highlightPost = "</mark>"
+	snippetRadius = 80
+)
+
+// movieSearchHit is a movie returned by search together with its relevance.
+// Match is "text" for full-text hits and "fuzzy" for typo-tolerant ones.
+type movieSearchHit struct {
+	models.Movie
+	Score      float64           `json:"score"`
+	Match      string            `json:"match"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// errScanLimit stops the fuzzy scan once fuzzyScanLimit movies were inspected.
+var errScanLimit = errors.New("scan limit reached")
+
+// ========================== SEARCH ==========================
+
+func SearchMovies(movies repository.MovieRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		text := strings.TrimSpace(c.Query("q"))
+		terms := utils.Tokenize(text)
+		if len(terms) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+			return
+		}
+
+		filter, err := parseMovieFilters(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		limit := defaultSearchLimit
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = min(n, maxSearchLimit)
+		}
+		fuzzy := c.DefaultQuery("fuzzy", "true") != "false"
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		found, err := movies.TextSearch(ctx, filter, text, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search movies"})
+			return
+		}
+		hits := make([]movieSearchHit, len(found))
+		for i, f := range found {
+			hits[i] = movieSearchHit{Movie: f.Movie, Score: f.Score, Match: "text"}
+		}
+
+		truncated := false
+		if fuzzy && len(hits) < limit {
+			seen := make(map[primitive.ObjectID]bool, len(hits))
+			for _, h := range hits {
+				seen[h.ID] = true
+			}
+			var extra []movieSearchHit
+			extra, truncated, err = fuzzySearch(ctx, movies, filter, terms, seen)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search movies"})
+				return
+			}
+			if len(extra) > limit-len(hits) {
+				extra = extra[:limit-len(hits)]
+			}
+			hits = append(hits, extra...)
+		}
+
+		for i := range hits {
+			hits[i].Highlights = highlightMovie(hits[i].Movie, terms)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"query": text, "count": len(hits), "data": hits, "fuzzy_truncated": truncated})
+	}
+}
+
+// fuzzySearch scans movies matching filter and scores them against terms
+// with edit-distance matching, so misspelled queries still find results.
+// Titles weigh more than reviews. Movies in skip are ignored. It reports
+// whether it stopped at fuzzyScanLimit before seeing every movie.
+func fuzzySearch(ctx context.Context, movies repository.MovieRepository, filter repository.MovieFilter, terms []string, skip map[primitive.ObjectID]bool) ([]movieSearchHit, bool, error) {
+	var hits []movieSearchHit
+	scanned := 0
+	err := movies.Each(ctx, filter, func(movie models.Movie) error {
+		if scanned++; scanned > fuzzyScanLimit {
+			return errScanLimit
+		}
+		if skip[movie.ID] {
+			return nil
+		}
+
+		score := max(utils.FuzzyScore(terms, movie.Title), 0.8*utils.FuzzyScore(terms, movie.AdminReview))
+		if score >= fuzzyMinScore {
+			hits = append(hits, movieSearchHit{Movie: movie, Score: score, Match: "fuzzy"})
+		}
+		return nil
+	})
+	truncated := errors.Is(err, errScanLimit)
+	if err != nil && !truncated {
+		return nil, false, err
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits, truncated, nil
+}
+
+// ========================== HIGHLIGHTING ==========================
+
+// highlightMovie marks the words of the title and review that match a search
+// term. Long reviews are cut down to a snippet around the first match.
+func highlightMovie(movie models.Movie, terms []string) map[string]string {
+	out := map[string]string{}
+	if title, ok := highlight(movie.Title, terms); ok {
+		out["title"] = title
+	}
+	if review, ok := highlight(snippet(movie.AdminReview, terms), terms); ok {
+		out["admin_review"] = review
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// highlight wraps every word of text that matches one of terms. It reports
+// whether anything was highlighted.
+func highlight(text string, terms []string) (string, bool) {
+	var b strings.Builder
+	found := false
+	forEachWord(text, func(word string, isWord bool) {
+		if isWord && matchesAnyTerm(word, terms) {
+			b.WriteString(highlightPre + word + highlightPost)
+			found = true
+			return
+		}
+		b.WriteString(word)
+	})
+	return b.String(), found
+}
+
+// snippet returns the part of text surrounding the first matching word.
+func snippet(text string, terms []string) string {
+	runes := []rune(text)
+	if len(runes) <= 2*snippetRadius {
+		return text
+	}
+
+	pos, offset := -1, 0
+	forEachWord(text, func(word string, isWord bool) {
+		if pos < 0 && isWord && matchesAnyTerm(word, terms) {
+			pos = offset
+		}
+		offset += len([]rune(word))
+	})
+	if pos < 0 {
+		return text
+	}
+
+	start := max(pos-snippetRadius, 0)
+	end := min(pos+snippetRadius, len(runes))
+	out := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(runes) {
+		out += "…"
+	}
+	return out
+}
+
+func matchesAnyTerm(word string, terms []string) bool {
+	norm := utils.Normalize(word)
+	for _, term := range terms {
+		if utils.TermScore(norm, term) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachWord splits text into alternating runs of word and non-word
+// characters and calls fn for each, so the text can be rebuilt verbatim.
+func forEachWord(text string, fn func(part string, isWord bool)) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		isWord := isWordRune(runes[i])
+		j := i + 1
+		for j < len(runes) && isWordRune(runes[j]) == isWord {
+			j++
+		}
+		fn(string(runes[i:j]), isWord)
+		i = j
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDeviceNameLength caps the device label taken from request headers.
+const maxDeviceNameLength = 200
+
+// ========================== SESSION HELPERS ==========================
+
+// deviceName labels a session with the X-Device-Name header, falling back to
+// the User-Agent.
+func deviceName(c *gin.Context) string {
+	name := strings.TrimSpace(c.GetHeader("X-Device-Name"))
+	if name == "" {
+		name = c.Request.UserAgent()
+	}
+	if name == "" {
+		name = "Unknown device"
+	}
+	if runes := []rune(name); len(runes) > maxDeviceNameLength {
+		name = string(runes[:maxDeviceNameLength])
+	}
+	return name
+}
+
+// startSession opens a new session for the user on the calling device and
+// returns its first token pair. mfa records whether a second factor was
+// checked.
+func startSession(ctx context.Context, c *gin.Context, sessions repository.SessionRepository, user models.User, mfa bool) (*utils.TokenPair, error) {
+	sessionID := utils.GenerateID()
+	tokens, err := utils.GenerateTokens(user.UserID, user.Role, sessionID, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = sessions.Create(ctx, models.Session{
+		SessionID:  sessionID,
+		UserID:     user.UserID,
+		Device:     deviceName(c),
+		IP:         c.ClientIP(),
+		RefreshID:  tokens.RefreshID,
+		MFA:        mfa,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  tokens.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// endSession revokes a session and denylists the access tokens already
+// issued for it, which would otherwise stay valid until they expire.
+func endSession(ctx context.Context, sessions repository.SessionRepository, denylist repository.DenylistRepository, sessionID, reason string) error {
+	now := time.Now()
+	if err := sessions.Revoke(ctx, sessionID, reason, now); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	return denylist.Add(ctx, repository.DenylistEntry{
+		Key:       repository.SessionDenyKey(sessionID),
+		Reason:    reason,
+		RevokedAt: now,
+		ExpiresAt: now.Add(utils.AccessTokenTTL),
+	})
+}
+
+// endOtherSessions ends every active session of the user except keep, which
+// may be empty. Unlike revokeUserAccess it denylists session by session, so
+// that the user can log in again right away.
+func endOtherSessions(ctx context.Context, sessions repository.SessionRepository, denylist repository.DenylistRepository, userID, keep, reason string) error {
+	active, err := sessions.ListActive(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range active {
+		if s.SessionID == keep {
+			continue
+		}
+		if err := endSession(ctx, sessions, denylist, s.SessionID, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeUserAccess ends every session of the user and denylists all their
+// access tokens, for accounts that must not be used any more. Tokens issued
+// in the same second are rejected too (see isRevoked in middleware).
+func revokeUserAccess(ctx context.Context, sessions repository.SessionRepository, denylist repository.DenylistRepository, userID, reason string) error {
+	now := time.Now()
+	if _, err := sessions.RevokeAll(ctx, userID, reason, now); err != nil {
+		return err
+	}
+	return denylist.Add(ctx, repository.DenylistEntry{
+		Key:       repository.UserDenyKey(userID),
+		Reason:    reason,
+		RevokedAt: now,
+		ExpiresAt: now.Add(utils.AccessTokenTTL),
+	})
+}
+
+// revokeReusedSession revokes a session whose refresh token was replayed.
+// Both the attacker and the legitimate client must log in again.
+func revokeReusedSession(ctx context.Context, sessions repository.SessionRepository, denylist repository.DenylistRepository, session models.Session) {
+	log.Printf("Refresh token reuse detected for session %s of user %s, revoking it", session.SessionID, session.UserID)
+	if err := endSession(ctx, sessions, denylist, session.SessionID, repository.RevokedTokenReuse); err != nil {
+		log.Printf("Failed to revoke session %s: %v", session.SessionID, err)
+	}
+}
+
+// ========================== REFRESH TOKEN ==========================
+func RefreshTokenHandler(users repository.UserRepository, sessions repository.SessionRepository, denylist repository.DenylistRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refresh := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if refresh == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token missing"})
+			return
+		}
+
+		claims, err := utils.ValidateRefreshToken(refresh)
+		if err != nil || claims.SessionID == "" || claims.ID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		session, err := sessions.Get(ctx, claims.SessionID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		now := time.Now()
+		if session.UserID != claims.UserID || !session.Active(now) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, please log in again"})
+			return
+		}
+		if session.RefreshID != claims.ID {
+			revokeReusedSession(ctx, sessions, denylist, session)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, please log in again"})
+			return
+		}
+
+		// Re-read the user so a role change applies from the next refresh
+		user, err := users.GetByUserID(ctx, claims.UserID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if user.Disabled || user.DeletedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, please log in again"})
+			return
+		}
+
+		tokens, err := utils.GenerateTokens(user.UserID, user.Role, session.SessionID, session.MFA)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+			return
+		}
+
+		err = sessions.Rotate(ctx, session.SessionID, claims.ID, tokens.RefreshID, now, tokens.RefreshExpiresAt)
+		if errors.Is(err, repository.ErrNotFound) {
+			// Another request rotated the same token first
+			revokeReusedSession(ctx, sessions, denylist, session)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, please log in again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"token": tokens.AccessToken, "refresh_token": tokens.RefreshToken})
+	}
+}
+
+// ========================== LOGOUT USER ==========================
+func LogoutHandler(sessions repository.SessionRepository, denylist repository.DenylistRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID, err := utils.GetSessionIdFromContext(c)
+		if err != nil {
+			// Tokens issued before sessions existed cannot be revoked
+			c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := endSession(ctx, sessions, denylist, sessionID, repository.RevokedLogout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	}
+}
+
+// ========================== LIST SESSIONS ==========================
+func GetSessions(sessions repository.SessionRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		current, _ := utils.GetSessionIdFromContext(c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		active, err := sessions.ListActive(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+			return
+		}
+
+		type sessionView struct {
+			models.Session
+			Current bool `json:"current"`
+		}
+		views := make([]sessionView, len(active))
+		for i, s := range active {
+			views[i] = sessionView{Session: s, Current: s.SessionID == current}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": views})
+	}
+}
+
+// ========================== REVOKE SESSION ==========================
+func RevokeSession(sessions repository.SessionRepository, denylist repository.DenylistRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Another user's session is reported as missing, not forbidden
+		session, err := sessions.Get(ctx, c.Param("session_id"))
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && (session.UserID != userID || !session.Active(time.Now()))) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if err := endSession(ctx, sessions, denylist, session.SessionID, repository.RevokedByUser); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+	}
+}
@@ -2,24 +2,25 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/samrato/magicstream/database"
 	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
 	"github.com/samrato/magicstream/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var userValidate = validator.New()
 
 // ========================== REGISTER USER ==========================
-func RegisterUser(client *mongo.Client) gin.HandlerFunc {
+func RegisterUser(users repository.UserRepository, sessions repository.SessionRepository, tokens repository.UserTokenRepository, mailer utils.Mailer, policy *utils.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var input models.UserRegister
 		if err := c.ShouldBindJSON(&input); err != nil {
@@ -35,19 +36,6 @@ func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "users")
-
-		// Check if email exists
-		count, err := collection.CountDocuments(ctx, bson.M{"email": input.Email})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-			return
-		}
-		if count > 0 {
-			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
-			return
-		}
-
 		// Hash password
 		hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -56,24 +44,34 @@ func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 		}
 
 		newUser := models.User{
-			// UserID:          utils.GenerateID(), // utility to generate unique user ID
+			UserID:          utils.GenerateID(),
 			FirstName:       input.FirstName,
 			LastName:        input.LastName,
 			Email:           input.Email,
 			Password:        string(hashed),
-			Role:            "USER",
+			Role:            policy.DefaultRole(),
 			FavouriteGenres: input.FavouriteGenres,
 			CreatedAt:       time.Now(),
 			UpdatedAt:       time.Now(),
 		}
 
-		result, err := collection.InsertOne(ctx, newUser)
+		// The unique index on email rejects duplicates, even concurrent ones
+		newUser, err = users.Create(ctx, newUser)
 		if err != nil {
+			if errors.Is(err, repository.ErrDuplicate) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 			return
 		}
 
-		accessToken, refreshToken, err := utils.GenerateTokens(newUser.UserID, newUser.Role)
+		// The account exists either way; the user can ask for a new link
+		if err := sendVerificationEmail(ctx, tokens, mailer, newUser); err != nil {
+			log.Printf("Failed to start email verification for user %s: %v", newUser.UserID, err)
+		}
+
+		pair, err := startSession(ctx, c, sessions, newUser, false)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 			return
@@ -86,15 +84,18 @@ func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 			"email":            newUser.Email,
 			"role":             newUser.Role,
 			"favourite_genres": newUser.FavouriteGenres,
-			"token":            accessToken,
-			"refresh_token":    refreshToken,
-			"inserted_id":      result.InsertedID,
+			"email_verified":   newUser.EmailVerified,
+			"token":            pair.AccessToken,
+			"refresh_token":    pair.RefreshToken,
+			"inserted_id":      newUser.ID,
 		})
 	}
 }
 
 // ========================== LOGIN USER ==========================
-func LoginUser(client *mongo.Client) gin.HandlerFunc {
+func LoginUser(users repository.UserRepository, sessions repository.SessionRepository, attempts repository.LoginAttemptRepository) gin.HandlerFunc {
+	throttle := newLoginThrottle(attempts)
+
 	return func(c *gin.Context) {
 		var input models.UserLogin
 		if err := c.ShouldBindJSON(&input); err != nil {
@@ -110,77 +111,79 @@ func LoginUser(client *mongo.Client) gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "users")
-		var user models.User
-		err := collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
+		// Every attempt counts as a failure until the password checks out.
+		// Throttled attempts are refused before the password is checked, and
+		// the same way whether or not the account exists
+		ip := c.ClientIP()
+		until, err := throttle.reserve(ctx, input.Email, ip)
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
-				return
-			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
-
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		if !until.IsZero() {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login attempts, please try again later"})
 			return
 		}
 
-		accessToken, refreshToken, err := utils.GenerateTokens(user.UserID, user.Role)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		user, err := users.GetByEmail(ctx, input.Email)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"user_id":          user.UserID,
-			"first_name":       user.FirstName,
-			"last_name":        user.LastName,
-			"email":            user.Email,
-			"role":             user.Role,
-			"favourite_genres": user.FavouriteGenres,
-			"token":            accessToken,
-			"refresh_token":    refreshToken,
-		})
-	}
-}
-
-// ========================== LOGOUT USER ==========================
-func LogoutHandler() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// In JWT, logout is handled client-side by deleting the token
-		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
-	}
-}
+		hash := []byte(user.Password)
+		known := err == nil && user.DeletedAt == nil
+		if !known {
+			hash = dummyPasswordHash()
+		}
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(input.Password)); err != nil || !known {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
 
-// ========================== REFRESH TOKEN ==========================
-func RefreshTokenHandler() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		refresh := c.GetHeader("Authorization")
-		if refresh == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token missing"})
+		// Only tell a disabled user once they have proven the password
+		if user.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
 			return
 		}
 
-		claims, err := utils.ValidateToken(refresh, []byte(utils.GetEnv("JWT_REFRESH_SECRET")))
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		// With two-factor authentication on, the password only earns a
+		// challenge token; failed logins are cleared once the code is checked
+		if mfaEnabled(user) {
+			throttle.passed(ctx, ip)
+			respondMFAChallenge(c, user)
 			return
 		}
+		throttle.succeeded(ctx, input.Email, ip)
 
-		accessToken, refreshToken, err := utils.GenerateTokens(claims.UserID, claims.Role)
+		pair, err := startSession(ctx, c, sessions, user, false)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"token": accessToken, "refresh_token": refreshToken})
+		c.JSON(http.StatusOK, loginResponse(user, pair))
+	}
+}
+
+// loginResponse is the body returned once a user is fully logged in.
+func loginResponse(user models.User, pair *utils.TokenPair) gin.H {
+	return gin.H{
+		"user_id":          user.UserID,
+		"first_name":       user.FirstName,
+		"last_name":        user.LastName,
+		"email":            user.Email,
+		"role":             user.Role,
+		"favourite_genres": user.FavouriteGenres,
+		"email_verified":   user.EmailVerified,
+		"token":            pair.AccessToken,
+		"refresh_token":    pair.RefreshToken,
 	}
 }
 
 // ========================== GET USER PROFILE ==========================
-func GetUserProfile(client *mongo.Client) gin.HandlerFunc {
+func GetUserProfile(users repository.UserRepository, policy *utils.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, err := utils.GetUserIdFromContext(c)
 		if err != nil {
@@ -191,11 +194,9 @@ func GetUserProfile(client *mongo.Client) gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "users")
-		var user models.User
-		err = collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user)
+		user, err := users.GetByUserID(ctx, userID)
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
+			if errors.Is(err, repository.ErrNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 				return
 			}
@@ -210,12 +211,14 @@ func GetUserProfile(client *mongo.Client) gin.HandlerFunc {
 			"email":            user.Email,
 			"role":             user.Role,
 			"favourite_genres": user.FavouriteGenres,
+			"email_verified":   user.EmailVerified,
+			"permissions":      policy.PermissionsOf(user.Role),
 		})
 	}
 }
 
 // ========================== UPDATE FAVOURITE GENRES ==========================
-func UpdateFavouriteGenres(client *mongo.Client) gin.HandlerFunc {
+func UpdateFavouriteGenres(users repository.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, err := utils.GetUserIdFromContext(c)
 		if err != nil {
@@ -239,9 +242,11 @@ func UpdateFavouriteGenres(client *mongo.Client) gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		collection := database.GetCollection(client, "users")
-		update := bson.M{"$set": bson.M{"favourite_genres": input.FavouriteGenres, "updated_at": time.Now()}}
-		_, err = collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+		err = users.UpdateFavouriteGenres(ctx, userID, input.FavouriteGenres)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update favourite genres"})
 			return
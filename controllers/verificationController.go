@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultEmailVerificationTTL = 48 * time.Hour
+	defaultVerificationResend   = 2 * time.Minute
+)
+
+// emailVerificationTTL is how long a verification link stays valid,
+// overridable with EMAIL_VERIFICATION_TTL.
+func emailVerificationTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultEmailVerificationTTL
+}
+
+// verificationResendInterval is the minimum time between two verification
+// emails to the same user, overridable with EMAIL_VERIFICATION_RESEND_INTERVAL.
+func verificationResendInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_RESEND_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultVerificationResend
+}
+
+// sendVerificationEmail replaces any outstanding verification link of the
+// user with a new one and emails it.
+func sendVerificationEmail(ctx context.Context, tokens repository.UserTokenRepository, mailer utils.Mailer, user models.User) error {
+	token, hash, err := utils.GenerateSecret()
+	if err != nil {
+		return err
+	}
+	if err := tokens.DeleteForUser(ctx, user.UserID, models.TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+
+	ttl := emailVerificationTTL()
+	now := time.Now()
+	err = tokens.Create(ctx, models.UserToken{
+		TokenHash: hash,
+		UserID:    user.UserID,
+		Purpose:   models.TokenPurposeEmailVerification,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	sendEmail(mailer, utils.Email{
+		To:      user.Email,
+		Subject: "Confirm your MagicStream email address",
+		Body: fmt.Sprintf("Hi %s,\n\nWelcome to MagicStream! Please confirm your email address with the link below. It expires in %s.\n\n%s\n\nIf you did not create an account, you can ignore this email.\n",
+			user.FirstName, ttl, appLink("/verify-email", token)),
+	})
+	return nil
+}
+
+// ========================== VERIFY EMAIL ==========================
+func VerifyEmail(users repository.UserRepository, tokens repository.UserTokenRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token string `json:"token" validate:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := userValidate.Struct(input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		token, err := tokens.Consume(ctx, models.TokenPurposeEmailVerification, utils.HashSecret(input.Token), now)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		err = users.MarkEmailVerified(ctx, token.UserID, now)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+	}
+}
+
+// ========================== RESEND VERIFICATION ==========================
+func ResendVerification(users repository.UserRepository, tokens repository.UserTokenRepository, mailer utils.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if user.EmailVerified {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+			return
+		}
+
+		last, err := tokens.Latest(ctx, userID, models.TokenPurposeEmailVerification)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err == nil {
+			if wait := verificationResendInterval() - time.Since(last.CreatedAt); wait > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "Verification email was sent recently, please wait before asking again"})
+				return
+			}
+		}
+
+		if err := sendVerificationEmail(ctx, tokens, mailer, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+	}
+}
@@ -47,3 +47,12 @@ func GetCollection(client *mongo.Client, collectionName string) *mongo.Collectio
 	log.Println("MongoDB connected successfully")
 	return client.Database(dbName).Collection(collectionName)
 }
+
+// GetDatabase returns the MongoDB database named by DATABASE_NAME
+func GetDatabase(client *mongo.Client) *mongo.Database {
+	dbName := os.Getenv("DATABASE_NAME")
+	if dbName == "" {
+		log.Fatal("DATABASE_NAME not set")
+	}
+	return client.Database(dbName)
+}
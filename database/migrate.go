@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationsCollection records which migrations have been applied.
+const MigrationsCollection = "schema_migrations"
+
+// Migration is one versioned schema change. Up and Down must be safe to run
+// again after a partial failure, because a migration is only recorded once Up
+// has returned.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// AppliedMigration is the record stored in schema_migrations.
+type AppliedMigration struct {
+	Version   int       `bson:"_id" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	AppliedAt time.Time `bson:"applied_at" json:"applied_at"`
+}
+
+// MigrationStatus reports whether a known migration has been applied.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator applies and reverts migrations against a database.
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the given migrations, ordered by version.
+func NewMigrator(db *mongo.Database, migrations []Migration) *Migrator {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{db: db, migrations: sorted}
+}
+
+// Applied returns the applied migrations keyed by version.
+func (m *Migrator) Applied(ctx context.Context) (map[int]AppliedMigration, error) {
+	cursor, err := m.db.Collection(MigrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []AppliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]AppliedMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		status[i] = MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			at := r.AppliedAt
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+// Up applies every pending migration up to and including target, or all of
+// them when target is 0. It stops at the first failure.
+func (m *Migrator) Up(ctx context.Context, target int) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range m.migrations {
+		if target > 0 && mig.Version > target {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if err := mig.Up(ctx, m.db); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		record := AppliedMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}
+		// Another instance starting at the same time may have recorded it
+		// first; the steps themselves are idempotent, so that is fine.
+		if _, err := m.db.Collection(MigrationsCollection).InsertOne(ctx, record); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return done, fmt.Errorf("recording migration %d: %w", mig.Version, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down reverts the given number of most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == nil {
+			return done, fmt.Errorf("migration %d (%s) cannot be reverted", mig.Version, mig.Name)
+		}
+		if err := mig.Down(ctx, m.db); err != nil {
+			return done, fmt.Errorf("reverting migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		if _, err := m.db.Collection(MigrationsCollection).DeleteOne(ctx, bson.M{"_id": mig.Version}); err != nil {
+			return done, fmt.Errorf("unrecording migration %d: %w", mig.Version, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Migrate applies every pending migration. It is called at startup.
+func Migrate(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	done, err := NewMigrator(GetDatabase(client), Migrations).Up(ctx, 0)
+	for _, mig := range done {
+		log.Printf("Applied migration %d: %s", mig.Version, mig.Name)
+	}
+	return err
+}
+
+// ========================== INDEX HELPERS ==========================
+
+func createIndexes(collection string, indexes ...mongo.IndexModel) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		return err
+	}
+}
+
+// dropIndexes ignores missing indexes and collections (IndexNotFound and
+// NamespaceNotFound), so reverting is idempotent.
+func dropIndexes(collection string, names ...string) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, name := range names {
+			_, err := db.Collection(collection).Indexes().DropOne(ctx, name)
+			var cmdErr mongo.CommandError
+			if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Code == 27 || cmdErr.Code == 26)) {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func uniqueIndex(name string, keys bson.D) mongo.IndexModel {
+	return mongo.IndexModel{Keys: keys, Options: options.Index().SetName(name).SetUnique(true)}
+}
+
+func index(name string, keys bson.D) mongo.IndexModel {
+	return mongo.IndexModel{Keys: keys, Options: options.Index().SetName(name)}
+}
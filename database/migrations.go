@@ -0,0 +1,295 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	"github.com/samrato/magicstream/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MovieTextIndex is the name of the text index used by movie search.
+const MovieTextIndex = "movies_text_search"
+
+// Migrations is the ordered list of schema changes. Never edit or renumber a
+// migration once released; add a new one instead.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "unique users.email",
+		Up:      createIndexes("users", uniqueIndex("users_email_unique", bson.D{{Key: "email", Value: 1}})),
+		Down:    dropIndexes("users", "users_email_unique"),
+	},
+	{
+		Version: 2,
+		Name:    "unique movies.imdb_id",
+		Up:      createIndexes("movies", uniqueIndex("movies_imdb_id_unique", bson.D{{Key: "imdb_id", Value: 1}})),
+		Down:    dropIndexes("movies", "movies_imdb_id_unique"),
+	},
+	{
+		Version: 3,
+		Name:    "movie search text index",
+		Up: createIndexes("movies", mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "title", Value: "text"},
+				{Key: "admin_review", Value: "text"},
+			},
+			Options: options.Index().
+				SetName(MovieTextIndex).
+				SetWeights(bson.D{
+					{Key: "title", Value: 10},
+					{Key: "admin_review", Value: 3},
+				}).
+				SetDefaultLanguage("english"),
+		}),
+		Down: dropIndexes("movies", MovieTextIndex),
+	},
+	{
+		// Listing sorts always tie-break on _id, and the recommendations
+		// filter on genre name while sorting by ranking.
+		Version: 4,
+		Name:    "movie listing indexes",
+		Up: createIndexes("movies",
+			index("movies_title_id", bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}}),
+			index("movies_ranking_id", bson.D{{Key: "ranking.ranking_value", Value: 1}, {Key: "_id", Value: 1}}),
+			index("movies_genre_ranking", bson.D{{Key: "genres.genre_name", Value: 1}, {Key: "ranking.ranking_value", Value: 1}}),
+			index("movies_deleted_at", bson.D{{Key: "deleted_at", Value: 1}}),
+		),
+		Down: dropIndexes("movies", "movies_title_id", "movies_ranking_id", "movies_genre_ranking", "movies_deleted_at"),
+	},
+	{
+		// Generated IDs are kept when reverting: issued tokens refer to them.
+		Version: 5,
+		Name:    "backfill users.user_id",
+		Up:      backfillUserIDs,
+		Down:    func(context.Context, *mongo.Database) error { return nil },
+	},
+	{
+		Version: 6,
+		Name:    "unique users.user_id",
+		Up:      createIndexes("users", uniqueIndex("users_user_id_unique", bson.D{{Key: "user_id", Value: 1}})),
+		Down:    dropIndexes("users", "users_user_id_unique"),
+	},
+	{
+		// Expired sessions are removed by the TTL index; revoked ones stay
+		// until then so a replayed refresh token is still recognised.
+		Version: 7,
+		Name:    "sessions indexes",
+		Up: createIndexes("sessions",
+			uniqueIndex("sessions_session_id_unique", bson.D{{Key: "session_id", Value: 1}}),
+			index("sessions_user_last_used", bson.D{{Key: "user_id", Value: 1}, {Key: "last_used_at", Value: -1}}),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("sessions_expires_at_ttl").SetExpireAfterSeconds(0),
+			},
+		),
+		Down: dropIndexes("sessions", "sessions_session_id_unique", "sessions_user_last_used", "sessions_expires_at_ttl"),
+	},
+	{
+		Version: 8,
+		Name:    "token denylist TTL index",
+		Up: createIndexes("token_denylist", mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("token_denylist_expires_at_ttl").SetExpireAfterSeconds(0),
+		}),
+		Down: dropIndexes("token_denylist", "token_denylist_expires_at_ttl"),
+	},
+	{
+		Version: 9,
+		Name:    "user tokens indexes",
+		Up: createIndexes("user_tokens",
+			uniqueIndex("user_tokens_hash_unique", bson.D{{Key: "token_hash", Value: 1}}),
+			index("user_tokens_user_purpose", bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("user_tokens_expires_at_ttl").SetExpireAfterSeconds(0),
+			},
+		),
+		Down: dropIndexes("user_tokens", "user_tokens_hash_unique", "user_tokens_user_purpose", "user_tokens_expires_at_ttl"),
+	},
+	{
+		// Accounts created before email verification existed are trusted.
+		Version: 10,
+		Name:    "mark existing users verified",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").UpdateMany(ctx,
+				bson.M{"email_verified": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"email_verified": true}})
+			return err
+		},
+		Down: func(context.Context, *mongo.Database) error { return nil },
+	},
+	{
+		Version: 11,
+		Name:    "users deletion index",
+		Up: createIndexes("users", mongo.IndexModel{
+			Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetName("users_deleted_at").SetSparse(true),
+		}),
+		Down: dropIndexes("users", "users_deleted_at"),
+	},
+	{
+		Version: 12,
+		Name:    "audit log and user listing indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := createIndexes("audit_log", mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "target_type", Value: 1},
+					{Key: "target_id", Value: 1},
+					{Key: "created_at", Value: -1},
+				},
+				Options: options.Index().SetName("audit_log_target"),
+			})(ctx, db)
+			if err != nil {
+				return err
+			}
+			return createIndexes("users", mongo.IndexModel{
+				Keys:    bson.D{{Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("users_created_at"),
+			})(ctx, db)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndexes("users", "users_created_at")(ctx, db); err != nil {
+				return err
+			}
+			return dropIndexes("audit_log", "audit_log_target")(ctx, db)
+		},
+	},
+	{
+		Version: 13,
+		Name:    "login attempts TTL index",
+		Up: createIndexes("login_attempts", mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("login_attempts_expires_at_ttl").SetExpireAfterSeconds(0),
+		}),
+		Down: dropIndexes("login_attempts", "login_attempts_expires_at_ttl"),
+	},
+	{
+		Version: 14,
+		Name:    "external identities and OIDC flow indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := createIndexes("user_identities",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}},
+					Options: options.Index().SetName("user_identities_provider_subject").SetUnique(true),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "provider", Value: 1}},
+					Options: options.Index().SetName("user_identities_user_provider").SetUnique(true),
+				},
+			)(ctx, db)
+			if err != nil {
+				return err
+			}
+			return createIndexes("oidc_flows",
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "state_hash", Value: 1}},
+					Options: options.Index().SetName("oidc_flows_state_hash").SetUnique(true),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "expires_at", Value: 1}},
+					Options: options.Index().SetName("oidc_flows_expires_at_ttl").SetExpireAfterSeconds(0),
+				},
+			)(ctx, db)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndexes("oidc_flows", "oidc_flows_state_hash", "oidc_flows_expires_at_ttl")(ctx, db); err != nil {
+				return err
+			}
+			return dropIndexes("user_identities", "user_identities_provider_subject", "user_identities_user_provider")(ctx, db)
+		},
+	},
+	{
+		Version: 15,
+		Name:    "api key indexes",
+		Up: createIndexes("api_keys",
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "key_hash", Value: 1}},
+				Options: options.Index().SetName("api_keys_key_hash").SetUnique(true),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("api_keys_user_created"),
+			},
+		),
+		Down: dropIndexes("api_keys", "api_keys_key_hash", "api_keys_user_created"),
+	},
+	{
+		Version: 16,
+		Name:    "job queue indexes",
+		Up: createIndexes("jobs",
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}},
+				Options: options.Index().SetName("jobs_status_run_at"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "locked_until", Value: 1}},
+				Options: options.Index().SetName("jobs_status_locked_until"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "type", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("jobs_type_status_created"),
+			},
+		),
+		Down: dropIndexes("jobs", "jobs_status_run_at", "jobs_status_locked_until", "jobs_type_status_created"),
+	},
+	{
+		Version: 17,
+		Name:    "rerank change indexes",
+		Up: createIndexes("rerank_changes",
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "run_id", Value: 1}, {Key: "outcome", Value: 1}, {Key: "imdb_id", Value: 1}},
+				Options: options.Index().SetName("rerank_changes_run_outcome"),
+			},
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "created_at", Value: 1}},
+				Options: options.Index().SetName("rerank_changes_ttl").SetExpireAfterSeconds(30 * 24 * 60 * 60),
+			},
+		),
+		Down: dropIndexes("rerank_changes", "rerank_changes_run_outcome", "rerank_changes_ttl"),
+	},
+}
+
+// backfillUserIDs gives every user without a user_id a generated one. The
+// filter re-checks the field so a concurrent run never overwrites an ID.
+func backfillUserIDs(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	missing := bson.M{"$or": bson.A{
+		bson.M{"user_id": bson.M{"$exists": false}},
+		bson.M{"user_id": ""},
+		bson.M{"user_id": nil},
+	}}
+
+	cursor, err := users.Find(ctx, missing, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var backfilled int
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		filter := bson.M{"$and": bson.A{bson.M{"_id": doc.ID}, missing}}
+		res, err := users.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"user_id": utils.GenerateID()}})
+		if err != nil {
+			return err
+		}
+		backfilled += int(res.ModifiedCount)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if backfilled > 0 {
+		log.Printf("Generated user_id for %d existing users", backfilled)
+	}
+	return nil
+}
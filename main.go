@@ -11,8 +11,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"github.com/samrato/magicstream/controllers"
 	"github.com/samrato/magicstream/database"
+	"github.com/samrato/magicstream/repository"
 	"github.com/samrato/magicstream/routes"
+	"github.com/samrato/magicstream/utils"
 )
 
 func main() {
@@ -21,6 +24,10 @@ func main() {
 		log.Println("Warning: .env file not found, using system environment variables")
 	}
 
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Initialize Gin router
 	router := gin.Default()
 
@@ -55,24 +62,107 @@ func main() {
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
-	// Connect to MongoDB
-	client := database.Connect()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Set up storage
+	var repos *repository.Repositories
+	if os.Getenv("STORAGE_BACKEND") == "memory" {
+		log.Println("Using in-memory storage, all data is lost on restart")
+		repos = repository.NewMemoryRepositories()
+	} else {
+		// Connect to MongoDB
+		client := database.Connect()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := client.Ping(ctx, nil); err != nil {
+			log.Fatalf("Failed to connect to MongoDB: %v", err)
+		}
+		defer func() {
+			if err := client.Disconnect(context.Background()); err != nil {
+				log.Fatalf("Failed to disconnect MongoDB: %v", err)
+			}
+		}()
+		log.Println("MongoDB connected successfully")
+
+		if os.Getenv("AUTO_MIGRATE") != "false" {
+			if err := database.Migrate(client); err != nil {
+				log.Fatalf("Failed to migrate MongoDB: %v", err)
+			}
+		}
+		repos = repository.NewMongoRepositories(client)
+	}
+
+	// Erase accounts whose deletion grace period has ended
+	go controllers.RunAccountErasure(context.Background(), repos)
+
+	// Load JWT signing keys
+	keyCfg, err := utils.KeyringConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid JWT key configuration: %v", err)
+	}
+	keyring := utils.NewKeyring(repos.Keys, keyCfg)
+	keyCtx, cancelKeys := context.WithTimeout(context.Background(), 30*time.Second)
+	err = keyring.Load(keyCtx)
+	cancelKeys()
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	utils.UseKeyring(keyring)
+	go keyring.RunRotation(context.Background())
 
-	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	// Load roles and their permissions
+	policy := utils.NewPolicy(repos.Roles)
+	roleCtx, cancelRoles := context.WithTimeout(context.Background(), 10*time.Second)
+	err = policy.Load(roleCtx)
+	if err == nil && os.Getenv("RBAC_ROLES_FILE") != "" {
+		err = policy.ApplyRolesFile(roleCtx, os.Getenv("RBAC_ROLES_FILE"))
 	}
-	defer func() {
-		if err := client.Disconnect(context.Background()); err != nil {
-			log.Fatalf("Failed to disconnect MongoDB: %v", err)
+	cancelRoles()
+	if err != nil {
+		log.Fatalf("Failed to load roles: %v", err)
+	}
+	if role := os.Getenv("DEFAULT_USER_ROLE"); role != "" {
+		if err := policy.UseDefaultRole(role); err != nil {
+			log.Fatalf("Invalid DEFAULT_USER_ROLE: %v", err)
 		}
-	}()
-	log.Println("MongoDB connected successfully")
+	}
+	if roles := os.Getenv("MFA_REQUIRED_ROLES"); roles != "" {
+		policy.RequireMFA(strings.Split(roles, ",")...)
+	}
+	go policy.RunReload(context.Background())
+
+	// Set up outgoing email
+	mailer, err := utils.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid mail configuration: %v", err)
+	}
+
+	// Load external identity providers for social login
+	providers := utils.OIDCProviders{}
+	if path := os.Getenv("OIDC_PROVIDERS_FILE"); path != "" {
+		providers, err = utils.LoadOIDCProviders(path)
+		if err != nil {
+			log.Fatalf("Invalid OIDC_PROVIDERS_FILE: %v", err)
+		}
+	}
+
+	// Set up review ranking
+	classifier, err := utils.NewSentimentClassifierFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid sentiment configuration: %v", err)
+	}
+	log.Printf("Ranking reviews with %s", classifier.Name())
+
+	// Start background job workers
+	queue := utils.NewJobQueue(repos.Jobs, utils.JobQueueConfigFromEnv())
+	queue.Handle(controllers.JobRankReview, controllers.RankReviewJob(repos.Movies, repos.Rankings, classifier))
+	queue.OnDead(controllers.JobRankReview, controllers.FailReviewRanking(repos.Movies))
+	queue.Handle(controllers.JobRerankCatalog, controllers.RerankCatalogJob(repos.Movies, repos.Rankings, classifier, repos.Reranks, queue))
+	go queue.Run(context.Background())
 
 	// Setup routes
-	routes.MovieRoutes(router, client)
-	routes.UserRoutes(router, client)
+	routes.WellKnownRoutes(router, keyring)
+	routes.MovieRoutes(router, repos, policy, classifier, queue)
+	routes.UserRoutes(router, repos, mailer, policy, providers)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -1,30 +0,0 @@
-package middleware
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-)
-
-func AdminOnly() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Unauthorized: role missing",
-			})
-			c.Abort()
-			return
-		}
-
-		if role != "ADMIN" {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Admin access required",
-			})
-			c.Abort()
-			return
-		}
-
-		c.Next()
-	}
-}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+)
+
+// apiKeyUseInterval limits how often a key's last use is written.
+const apiKeyUseInterval = time.Minute
+
+// apiKeyFromRequest returns the API key sent in the X-API-Key header or as a
+// bearer token, or "" when the request carries none.
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && utils.IsAPIKey(token) {
+		return token
+	}
+	return ""
+}
+
+// AcceptAPIKeys lets a route group be called with an API key instead of an
+// access token. It must run before AuthMiddleware, which then skips the
+// token check. The key acts with its owner's current role, and
+// RequirePermission and RequireScope also check its scopes, so only use it
+// on groups where every route checks one of them.
+func AcceptAPIKeys(apiKeys repository.APIKeyRepository, users repository.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := apiKeyFromRequest(c)
+		if raw == "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key, err := apiKeys.GetByHash(ctx, utils.HashSecret(raw))
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify API key"})
+			c.Abort()
+			return
+		}
+		if err != nil || key.RevokedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+		now := time.Now()
+		if !now.Before(key.ExpiresAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+			c.Abort()
+			return
+		}
+
+		// The owner's account decides the role, so that disabling the owner
+		// or changing their role applies to their keys at once
+		owner, err := users.GetByUserID(ctx, key.UserID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify API key"})
+			c.Abort()
+			return
+		}
+		if err != nil || owner.DeletedAt != nil || owner.Disabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUseInterval {
+			if err := apiKeys.RecordUse(ctx, key.KeyID, now, c.ClientIP()); err != nil {
+				log.Printf("Failed to record use of API key %s: %v", key.KeyID, err)
+			}
+		}
+
+		c.Set("user_id", owner.UserID)
+		c.Set("role", owner.Role)
+		c.Set("session_id", "")
+		// Keys can only be created from a session that met the owner's
+		// two-factor requirement at the time, so one added later is not met
+		c.Set("mfa", key.MFA)
+		c.Set("api_key_id", key.KeyID)
+		c.Set("api_key_scopes", key.Scopes)
+		c.Next()
+	}
+}
+
+// RequireScope checks that an API key grants scope. Requests with an access
+// token pass, so it guards routes that any logged-in user may call but that
+// a key should only reach when scoped for it. It must run after
+// AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scopes, ok := utils.GetAPIKeyScopesFromContext(c); ok && !utils.ScopesGrant(scopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "API key is not allowed to do this",
+				"scope": scope,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,15 +1,25 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samrato/magicstream/repository"
 	"github.com/samrato/magicstream/utils"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates the bearer access token and rejects tokens that
+// were revoked through the denylist. Requests already authenticated by
+// AcceptAPIKeys pass through.
+func AuthMiddleware(denylist repository.DenylistRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if _, ok := utils.GetAPIKeyScopesFromContext(c); ok {
+			c.Next()
+			return
+		}
+
 		auth := c.GetHeader("Authorization")
 
 		if auth == "" {
@@ -25,15 +35,59 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := utils.ValidateToken(parts[1], []byte(utils.GetEnv("JWT_SECRET")))
+		claims, err := utils.ValidateAccessToken(parts[1])
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		// Tokens issued before user IDs were generated carry an empty ID
+		if claims.UserID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		revoked, err := isRevoked(c.Request.Context(), denylist, claims)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("session_id", claims.SessionID)
+		c.Set("mfa", claims.MFA)
 		c.Next()
 	}
 }
+
+// isRevoked reports whether a denylist entry for the token, its session or
+// its user was recorded at or after the token was issued. Issue times only
+// have second precision, so a token issued in the same second as a user-wide
+// revocation is rejected too.
+func isRevoked(ctx context.Context, denylist repository.DenylistRepository, claims *utils.Claims) (bool, error) {
+	keys := []string{repository.UserDenyKey(claims.UserID)}
+	if claims.ID != "" {
+		keys = append(keys, repository.TokenDenyKey(claims.ID))
+	}
+	if claims.SessionID != "" {
+		keys = append(keys, repository.SessionDenyKey(claims.SessionID))
+	}
+
+	revokedAt, found, err := denylist.LatestRevocation(ctx, keys)
+	if err != nil || !found {
+		return false, err
+	}
+	if claims.IssuedAt == nil {
+		return true, nil
+	}
+	return !claims.IssuedAt.After(revokedAt), nil
+}
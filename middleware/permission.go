@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samrato/magicstream/utils"
+)
+
+// RequirePermission only lets through users whose role grants perm, and API
+// keys whose scopes also grant it. Roles that require two-factor
+// authentication must also have logged in with it.
+// It must run after AuthMiddleware.
+func RequirePermission(policy *utils.Policy, perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := utils.GetRoleFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized: role missing",
+			})
+			c.Abort()
+			return
+		}
+
+		if !policy.Allows(role, perm) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "You do not have permission to do this",
+				"permission": perm,
+			})
+			c.Abort()
+			return
+		}
+
+		if scopes, ok := utils.GetAPIKeyScopesFromContext(c); ok && !utils.ScopesGrant(scopes, perm) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "API key is not allowed to do this",
+				"permission": perm,
+			})
+			c.Abort()
+			return
+		}
+
+		if _, ok := utils.GetAPIKeyScopesFromContext(c); ok && policy.MFARequired(role) && !utils.GetMFAFromContext(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":        "Two-factor authentication became required for this key's owner after it was created, create a new key",
+				"mfa_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		if policy.MFARequired(role) && !utils.GetMFAFromContext(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":        "Two-factor authentication is required, enable it and log in again",
+				"mfa_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
+)
+
+// Email verification policies, set with EMAIL_VERIFICATION_POLICY.
+const (
+	VerificationOff    = "off"    // never block unverified users
+	VerificationWrites = "writes" // block changes, allow reads (default)
+	VerificationAll    = "all"    // block every request
+)
+
+// RequireVerifiedEmail blocks users who have not verified their email
+// address, according to EMAIL_VERIFICATION_POLICY. It must run after
+// AuthMiddleware.
+func RequireVerifiedEmail(users repository.UserRepository) gin.HandlerFunc {
+	policy := os.Getenv("EMAIL_VERIFICATION_POLICY")
+	switch policy {
+	case VerificationOff, VerificationWrites, VerificationAll:
+	case "":
+		policy = VerificationWrites
+	default:
+		log.Printf("Unknown EMAIL_VERIFICATION_POLICY %q, using %q", policy, VerificationWrites)
+		policy = VerificationWrites
+	}
+
+	return func(c *gin.Context) {
+		if policy == VerificationOff {
+			c.Next()
+			return
+		}
+		if policy == VerificationWrites {
+			switch c.Request.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				c.Next()
+				return
+			}
+		}
+
+		userID, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := users.GetByUserID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+		if !user.EmailVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
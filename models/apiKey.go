@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// =======================
+// API Key
+// =======================
+// A long-lived credential for scripts and services. It acts as the user who
+// created it, limited to its scopes. Only the hash of the key is stored.
+type APIKey struct {
+	KeyID   string `bson:"_id" json:"key_id"`
+	Name    string `bson:"name" json:"name"`
+	Prefix  string `bson:"prefix" json:"prefix"` // first characters, to recognise the key
+	KeyHash string `bson:"key_hash" json:"-"`
+	// UserID is the owner whose role the key acts with.
+	UserID     string     `bson:"user_id" json:"user_id"`
+	Scopes     []string   `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt  time.Time  `bson:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	LastUsedIP string     `bson:"last_used_ip,omitempty" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	// MFA records whether the owner's role required two-factor
+	// authentication when the key was created; the key only counts as having
+	// passed requirements that held then.
+	MFA bool `bson:"mfa" json:"mfa"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// =======================
+// Audit Log Entry
+// =======================
+// An audit entry records an administrative change: who made it (ActorID),
+// what was done (Action) and to what (TargetType and TargetID). Entries are
+// append-only and are kept when the target account is erased.
+type AuditEntry struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	ActorID    string                 `bson:"actor_id" json:"actor_id"`
+	Action     string                 `bson:"action" json:"action"`
+	TargetType string                 `bson:"target_type" json:"target_type"`
+	TargetID   string                 `bson:"target_id" json:"target_id"`
+	Details    map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	IP         string                 `bson:"ip,omitempty" json:"ip,omitempty"`
+	CreatedAt  time.Time              `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// =======================
+// External Identity
+// =======================
+// An account at an external identity provider linked to a user. A user has
+// at most one identity per provider.
+type UserIdentity struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID      string             `bson:"user_id" json:"-"`
+	Provider    string             `bson:"provider" json:"provider"`
+	Subject     string             `bson:"subject" json:"subject"`
+	Email       string             `bson:"email,omitempty" json:"email,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	LastLoginAt *time.Time         `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
+}
+
+// =======================
+// Pending OIDC Login
+// =======================
+// An authorization code flow that was started but not finished. It is
+// looked up by the hash of its state parameter and used once.
+type OIDCFlow struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	StateHash    string             `bson:"state_hash"`
+	Provider     string             `bson:"provider"`
+	Nonce        string             `bson:"nonce"`
+	CodeVerifier string             `bson:"code_verifier"`
+	// LinkUserID is set when a logged-in user is linking the provider to
+	// their account rather than logging in.
+	LinkUserID string    `bson:"link_user_id,omitempty"`
+	CreatedAt  time.Time `bson:"created_at"`
+	ExpiresAt  time.Time `bson:"expires_at"`
+}
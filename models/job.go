@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Job statuses. A failed attempt puts the job back to queued with a later
+// run_at until it runs out of attempts and becomes dead.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// Movie ranking statuses while a review is classified in the background.
+const (
+	RankingPending = "pending"
+	RankingRanked  = "ranked"
+	RankingFailed  = "failed"
+)
+
+// =======================
+// Job
+// =======================
+// A unit of background work, claimed by one worker at a time through a lease
+// that expires if the worker dies.
+type Job struct {
+	JobID       string            `bson:"_id" json:"job_id"`
+	Type        string            `bson:"type" json:"type"`
+	Status      string            `bson:"status" json:"status"`
+	Payload     map[string]string `bson:"payload" json:"payload"`
+	Result      map[string]string `bson:"result,omitempty" json:"result,omitempty"`
+	Attempts    int               `bson:"attempts" json:"attempts"`
+	MaxAttempts int               `bson:"max_attempts" json:"max_attempts"`
+	LastError   string            `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	Progress    *JobProgress      `bson:"progress,omitempty" json:"progress,omitempty"`
+	// RunAt is when the job may next be claimed.
+	RunAt       time.Time  `bson:"run_at" json:"run_at"`
+	LockedBy    string     `bson:"locked_by,omitempty" json:"-"`
+	LockedUntil *time.Time `bson:"locked_until,omitempty" json:"-"`
+	CallbackURL string     `bson:"callback_url,omitempty" json:"callback_url,omitempty"`
+	// CallbackStatus is "delivered" or "failed" once the callback was tried.
+	CallbackStatus string     `bson:"callback_status,omitempty" json:"callback_status,omitempty"`
+	CreatedBy      string     `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt      time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `bson:"updated_at" json:"updated_at"`
+	FinishedAt     *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// JobProgress reports how far a long-running job has come. Counts breaks
+// Done down by outcome.
+type JobProgress struct {
+	Total  int            `bson:"total" json:"total"`
+	Done   int            `bson:"done" json:"done"`
+	Counts map[string]int `bson:"counts,omitempty" json:"counts,omitempty"`
+}
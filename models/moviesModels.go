@@ -1,5 +1,7 @@
 package models
 import (
+    "time"
+
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -22,4 +24,8 @@ type Movie struct {
     Genres      []Genre            `bson:"genres" json:"genres" validate:"required,dive"`
     AdminReview string             `bson:"admin_review" json:"admin_review"`
     Ranking     Ranking            `bson:"ranking" json:"ranking" validate:"required"`
+    // RankingStatus is set while the review is classified in the background.
+    RankingStatus string           `bson:"ranking_status,omitempty" json:"ranking_status,omitempty"`
+    RankingJobID  string           `bson:"ranking_job_id,omitempty" json:"ranking_job_id,omitempty"`
+    DeletedAt   *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
 }
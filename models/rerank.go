@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Outcomes of re-ranking one movie.
+const (
+	RerankUnchanged = "unchanged"
+	RerankChanged   = "changed"
+	RerankSkipped   = "skipped"
+	RerankFailed    = "failed"
+)
+
+// =======================
+// Rerank Change
+// =======================
+// What a catalog re-ranking run found for one movie. Together they form the
+// run's diff, and they let a run that was interrupted skip the movies it has
+// already done.
+type RerankChange struct {
+	ID         string    `bson:"_id" json:"-"`
+	RunID      string    `bson:"run_id" json:"run_id"`
+	ImdbID     string    `bson:"imdb_id" json:"imdb_id"`
+	Title      string    `bson:"title" json:"title"`
+	Outcome    string    `bson:"outcome" json:"outcome"`
+	OldRanking Ranking   `bson:"old_ranking" json:"old_ranking"`
+	NewRanking *Ranking  `bson:"new_ranking,omitempty" json:"new_ranking,omitempty"`
+	Classifier string    `bson:"classifier,omitempty" json:"classifier,omitempty"`
+	Applied    bool      `bson:"applied" json:"applied"`
+	Reason     string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+}
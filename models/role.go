@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// =======================
+// Role
+// =======================
+// A role grants its permissions to every user holding it. "*" grants every
+// permission, and "movies:*" every permission starting with "movies:".
+type Role struct {
+	Name        string    `bson:"_id" json:"name"`
+	Description string    `bson:"description,omitempty" json:"description,omitempty"`
+	Permissions []string  `bson:"permissions" json:"permissions"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
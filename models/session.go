@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// =======================
+// Login Session (one per device)
+// =======================
+// A session is a refresh-token family: every refresh replaces RefreshID with
+// the jti of the newly issued refresh token. Presenting any older token of
+// the family revokes the whole session.
+type Session struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	SessionID     string             `bson:"session_id" json:"session_id"`
+	UserID        string             `bson:"user_id" json:"-"`
+	Device        string             `bson:"device" json:"device"`
+	IP            string             `bson:"ip" json:"ip"`
+	RefreshID     string             `bson:"refresh_id" json:"-"`
+	MFA           bool               `bson:"mfa,omitempty" json:"mfa"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt    time.Time          `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt     time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt     *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	RevokedReason string             `bson:"revoked_reason,omitempty" json:"revoked_reason,omitempty"`
+}
+
+// Active reports whether the session can still be used at the given time.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
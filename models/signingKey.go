@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// =======================
+// JWT Signing Key
+// =======================
+// A key signs new tokens from CreatedAt until a newer key is created, and
+// keeps verifying them for the configured retention period after that.
+type SigningKey struct {
+	KeyID      string    `bson:"_id" json:"kid"`
+	Algorithm  string    `bson:"alg" json:"alg"`
+	PrivateKey string    `bson:"private_key" json:"-"` // PKCS#8 PEM, sealed when encrypted at rest
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+}
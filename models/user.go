@@ -17,11 +17,31 @@ type User struct {
 	Email           string             `bson:"email" json:"email"`
 	Password        string             `bson:"password" json:"password"` // hashed password
 	Role            string             `bson:"role" json:"role"`
+	EmailVerified   bool               `bson:"email_verified" json:"email_verified"`
+	EmailVerifiedAt *time.Time         `bson:"email_verified_at,omitempty" json:"email_verified_at,omitempty"`
 	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
 	Token           string             `bson:"token,omitempty" json:"token,omitempty"`
 	RefreshToken    string             `bson:"refresh_token,omitempty" json:"refresh_token,omitempty"`
 	FavouriteGenres []Genre            `bson:"favourite_genres" json:"favourite_genres"`
+	MFA             *UserMFA           `bson:"mfa,omitempty" json:"-"`
+	Disabled        bool               `bson:"disabled,omitempty" json:"disabled"`
+	DisabledAt      *time.Time         `bson:"disabled_at,omitempty" json:"disabled_at,omitempty"`
+	DeletedAt       *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	AnonymisedAt    *time.Time         `bson:"anonymised_at,omitempty" json:"anonymised_at,omitempty"`
+}
+
+// UserMFA holds a user's TOTP authenticator. The secret is stored as soon as
+// enrolment starts, but only counts once Enabled is set by a verified code.
+type UserMFA struct {
+	Secret    string     `bson:"secret"` // base32
+	Enabled   bool       `bson:"enabled"`
+	EnabledAt *time.Time `bson:"enabled_at,omitempty"`
+	// RecoveryCodes are SHA-256 hashes of the unused recovery codes.
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+	// LastUsedStep is the time step of the last accepted code, so that a
+	// code cannot be replayed.
+	LastUsedStep int64 `bson:"last_used_step,omitempty"`
 }
 
 // =======================
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// =======================
+// One-time User Token
+// =======================
+// Password reset links and similar single-use secrets. Only the hash of the
+// token is stored.
+type UserToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Purpose   string             `bson:"purpose" json:"purpose"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+}
+
+// Purposes of a UserToken.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// APIKeyRepository stores hashed API keys.
+type APIKeyRepository interface {
+	UserDataEraser
+	// Create stores a key. It returns ErrDuplicate when the hash is taken.
+	Create(ctx context.Context, key models.APIKey) error
+	Get(ctx context.Context, keyID string) (models.APIKey, error)
+	GetByHash(ctx context.Context, keyHash string) (models.APIKey, error)
+	// List returns the user's keys, or every key when userID is empty,
+	// newest first.
+	List(ctx context.Context, userID string) ([]models.APIKey, error)
+	// Revoke marks the key revoked. It returns ErrNotFound if the key does
+	// not exist or is revoked already.
+	Revoke(ctx context.Context, keyID string, at time.Time) error
+	RecordUse(ctx context.Context, keyID string, at time.Time, ip string) error
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser   = "user"
+	AuditTargetRole   = "role"
+	AuditTargetAPIKey = "api_key"
+)
+
+// Audit actions recorded for admin changes to user accounts.
+const (
+	AuditUserRoleChanged = "user.role_changed"
+	AuditUserDisabled    = "user.disabled"
+	AuditUserEnabled     = "user.enabled"
+	AuditUserLoggedOut   = "user.force_logout"
+	AuditUserUnlocked    = "user.login_unlocked"
+	AuditUserMFAReset    = "user.mfa_reset"
+)
+
+// Audit actions recorded for changes to role definitions.
+const (
+	AuditRoleSaved   = "role.saved"
+	AuditRoleDeleted = "role.deleted"
+)
+
+// Audit actions recorded for API keys.
+const (
+	AuditAPIKeyCreated = "api_key.created"
+	AuditAPIKeyRevoked = "api_key.revoked"
+)
+
+// AuditRepository stores the append-only audit log.
+type AuditRepository interface {
+	Record(ctx context.Context, entry models.AuditEntry) error
+	// ListForTarget returns up to limit entries about the target, newest first.
+	ListForTarget(ctx context.Context, targetType, targetID string, limit int) ([]models.AuditEntry, error)
+}
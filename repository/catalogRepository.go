@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// GenreRepository stores the genre list.
+type GenreRepository interface {
+	List(ctx context.Context) ([]models.Genre, error)
+	Each(ctx context.Context, fn func(models.Genre) error) error
+}
+
+// RankingRepository stores the ranking scale used to classify reviews.
+type RankingRepository interface {
+	List(ctx context.Context) ([]models.Ranking, error)
+	Each(ctx context.Context, fn func(models.Ranking) error) error
+}
+
+// DefaultGenres seeds the in-memory genre repository.
+var DefaultGenres = []models.Genre{
+	{GenreID: 1, GenreName: "Comedy"},
+	{GenreID: 2, GenreName: "Drama"},
+	{GenreID: 3, GenreName: "Western"},
+	{GenreID: 4, GenreName: "Fantasy"},
+	{GenreID: 5, GenreName: "Thriller"},
+	{GenreID: 6, GenreName: "Sci-Fi"},
+	{GenreID: 7, GenreName: "Action"},
+	{GenreID: 8, GenreName: "Mystery"},
+	{GenreID: 9, GenreName: "Crime"},
+}
+
+// DefaultRankings seeds the in-memory ranking repository. Lower values are
+// better; 999 marks a movie that has not been ranked yet.
+var DefaultRankings = []models.Ranking{
+	{RankingValue: 1, RankingName: "Excellent"},
+	{RankingValue: 2, RankingName: "Good"},
+	{RankingValue: 3, RankingName: "Okay"},
+	{RankingValue: 4, RankingName: "Bad"},
+	{RankingValue: 5, RankingName: "Terrible"},
+	{RankingValue: 999, RankingName: "Not_Ranked"},
+}
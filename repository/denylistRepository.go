@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// DenylistEntry revokes every access token matching Key that was issued at
+// or before RevokedAt. Entries are dropped once ExpiresAt has passed, by which
+// time every token they could match has expired anyway.
+type DenylistEntry struct {
+	Key       string    `bson:"_id" json:"key"`
+	Reason    string    `bson:"reason" json:"reason"`
+	RevokedAt time.Time `bson:"revoked_at" json:"revoked_at"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// DenylistRepository stores revoked access tokens until they expire.
+type DenylistRepository interface {
+	// Add records the entry. Adding a key twice keeps the latest revocation.
+	Add(ctx context.Context, entry DenylistEntry) error
+	// LatestRevocation returns the most recent revocation time recorded for
+	// any of the keys, and false when none of them is denied.
+	LatestRevocation(ctx context.Context, keys []string) (time.Time, bool, error)
+}
+
+// Denylist keys. A token is checked against all three, so a single entry can
+// revoke one token, every token of a session or every token of a user.
+func TokenDenyKey(jti string) string         { return "jti:" + jti }
+func SessionDenyKey(sessionID string) string { return "sid:" + sessionID }
+func UserDenyKey(userID string) string       { return "user:" + userID }
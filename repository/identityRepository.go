@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// IdentityRepository stores the external identities linked to users.
+type IdentityRepository interface {
+	UserDataEraser
+	// Create links an identity. It returns ErrDuplicate when the provider
+	// account is linked already, or the user already has one for provider.
+	Create(ctx context.Context, identity models.UserIdentity) error
+	Get(ctx context.Context, provider, subject string) (models.UserIdentity, error)
+	ListForUser(ctx context.Context, userID string) ([]models.UserIdentity, error)
+	// Delete unlinks the user's identity at provider.
+	Delete(ctx context.Context, userID, provider string) error
+	RecordLogin(ctx context.Context, provider, subject string, at time.Time) error
+}
+
+// OIDCFlowRepository stores pending authorization code flows.
+type OIDCFlowRepository interface {
+	Create(ctx context.Context, flow models.OIDCFlow) error
+	// Consume deletes and returns the unexpired flow with the state hash, so
+	// each state can be used once.
+	Consume(ctx context.Context, stateHash string, now time.Time) (models.OIDCFlow, error)
+}
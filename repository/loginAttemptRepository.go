@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// LoginAttempt counts the failed logins recorded under Key since the counter
+// was last reset. The counter is dropped once ExpiresAt has passed.
+type LoginAttempt struct {
+	Key           string    `bson:"_id" json:"key"`
+	Failures      int       `bson:"failures" json:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at" json:"last_failure_at"`
+	ExpiresAt     time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// LoginAttemptRepository tracks failed logins, shared by every instance.
+type LoginAttemptRepository interface {
+	// Get returns the unexpired counters among keys. Keys without failures
+	// are left out.
+	Get(ctx context.Context, keys []string) ([]LoginAttempt, error)
+	// RecordFailure atomically counts a failure under key, pushing its
+	// expiry to expiresAt, and returns the counter as it was before, which
+	// is zero when there was none or it had expired.
+	RecordFailure(ctx context.Context, key string, at, expiresAt time.Time) (LoginAttempt, error)
+	// Forgive takes back one failure counted under key.
+	Forgive(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+	// EraseEmail drops the counter of an erased account's email address.
+	EraseEmail(ctx context.Context, email string) error
+}
+
+// Login attempt keys. Failures are counted both for the email address tried,
+// whether or not an account uses it, and for the client IP.
+func AccountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+func IPAttemptKey(ip string) string { return "ip:" + ip }
+
+// PasswordResetAttemptKey counts the password reset requests of a client IP,
+// apart from its logins.
+func PasswordResetAttemptKey(ip string) string { return "reset-ip:" + ip }
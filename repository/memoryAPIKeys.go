@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+type memoryAPIKeyRepository struct {
+	mu   sync.Mutex
+	keys map[string]models.APIKey // keyed by key ID
+}
+
+// NewMemoryAPIKeyRepository returns an empty, thread-safe in-memory
+// APIKeyRepository.
+func NewMemoryAPIKeyRepository() APIKeyRepository {
+	return &memoryAPIKeyRepository{keys: map[string]models.APIKey{}}
+}
+
+func cloneAPIKey(k models.APIKey) models.APIKey {
+	k.Scopes = append([]string(nil), k.Scopes...)
+	if k.LastUsedAt != nil {
+		t := *k.LastUsedAt
+		k.LastUsedAt = &t
+	}
+	if k.RevokedAt != nil {
+		t := *k.RevokedAt
+		k.RevokedAt = &t
+	}
+	return k
+}
+
+func (r *memoryAPIKeyRepository) Create(ctx context.Context, key models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[key.KeyID]; ok {
+		return ErrDuplicate
+	}
+	for _, k := range r.keys {
+		if k.KeyHash == key.KeyHash {
+			return ErrDuplicate
+		}
+	}
+	r.keys[key.KeyID] = cloneAPIKey(key)
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) Get(ctx context.Context, keyID string) (models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[keyID]
+	if !ok {
+		return models.APIKey{}, ErrNotFound
+	}
+	return cloneAPIKey(k), nil
+}
+
+func (r *memoryAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.KeyHash == keyHash {
+			return cloneAPIKey(k), nil
+		}
+	}
+	return models.APIKey{}, ErrNotFound
+}
+
+func (r *memoryAPIKeyRepository) List(ctx context.Context, userID string) ([]models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []models.APIKey{}
+	for _, k := range r.keys {
+		if userID == "" || k.UserID == userID {
+			keys = append(keys, cloneAPIKey(k))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (r *memoryAPIKeyRepository) Revoke(ctx context.Context, keyID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.keys[keyID]
+	if !ok || k.RevokedAt != nil {
+		return ErrNotFound
+	}
+	k.RevokedAt = &at
+	r.keys[keyID] = k
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) RecordUse(ctx context.Context, keyID string, at time.Time, ip string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if k, ok := r.keys[keyID]; ok {
+		k.LastUsedAt, k.LastUsedIP = &at, ip
+		r.keys[keyID] = k
+	}
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) EraseUser(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, k := range r.keys {
+		if k.UserID == userID {
+			delete(r.keys, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryAuditRepository struct {
+	mu      sync.RWMutex
+	entries []models.AuditEntry // in insertion order
+}
+
+// NewMemoryAuditRepository returns an empty, thread-safe in-memory
+// AuditRepository.
+func NewMemoryAuditRepository() AuditRepository {
+	return &memoryAuditRepository{}
+}
+
+func cloneAuditEntry(e models.AuditEntry) models.AuditEntry {
+	if e.Details != nil {
+		details := make(map[string]interface{}, len(e.Details))
+		for k, v := range e.Details {
+			details[k] = v
+		}
+		e.Details = details
+	}
+	return e
+}
+
+func (r *memoryAuditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry = cloneAuditEntry(entry)
+	entry.ID = primitive.NewObjectID()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *memoryAuditRepository) ListForTarget(ctx context.Context, targetType, targetID string, limit int) ([]models.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := []models.AuditEntry{}
+	for i := len(r.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		e := r.entries[i]
+		if e.TargetType == targetType && e.TargetID == targetID {
+			entries = append(entries, cloneAuditEntry(e))
+		}
+	}
+	return entries, nil
+}
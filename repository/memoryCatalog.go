@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// memoryList is a read-only, thread-safe list shared by the in-memory genre
+// and ranking repositories.
+type memoryList[T any] struct {
+	mu    sync.RWMutex
+	items []T
+}
+
+func (l *memoryList[T]) List(ctx context.Context) ([]T, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]T(nil), l.items...), nil
+}
+
+func (l *memoryList[T]) Each(ctx context.Context, fn func(T) error) error {
+	items, _ := l.List(ctx)
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewMemoryGenreRepository returns an in-memory GenreRepository holding genres.
+func NewMemoryGenreRepository(genres ...models.Genre) GenreRepository {
+	return &memoryList[models.Genre]{items: append([]models.Genre(nil), genres...)}
+}
+
+// NewMemoryRankingRepository returns an in-memory RankingRepository holding
+// rankings.
+func NewMemoryRankingRepository(rankings ...models.Ranking) RankingRepository {
+	return &memoryList[models.Ranking]{items: append([]models.Ranking(nil), rankings...)}
+}
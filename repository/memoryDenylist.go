@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryDenylistRepository struct {
+	mu      sync.RWMutex
+	entries map[string]DenylistEntry
+}
+
+// NewMemoryDenylistRepository returns an empty, thread-safe in-memory
+// DenylistRepository. Expired entries are pruned whenever one is added.
+func NewMemoryDenylistRepository() DenylistRepository {
+	return &memoryDenylistRepository{entries: map[string]DenylistEntry{}}
+}
+
+func (r *memoryDenylistRepository) Add(ctx context.Context, entry DenylistEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, e := range r.entries {
+		if !e.ExpiresAt.After(now) {
+			delete(r.entries, key)
+		}
+	}
+
+	if old, ok := r.entries[entry.Key]; ok {
+		if old.RevokedAt.After(entry.RevokedAt) {
+			entry.RevokedAt = old.RevokedAt
+		}
+		if old.ExpiresAt.After(entry.ExpiresAt) {
+			entry.ExpiresAt = old.ExpiresAt
+		}
+	}
+	r.entries[entry.Key] = entry
+	return nil
+}
+
+func (r *memoryDenylistRepository) LatestRevocation(ctx context.Context, keys []string) (time.Time, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var latest time.Time
+	found := false
+	for _, key := range keys {
+		e, ok := r.entries[key]
+		if !ok || !e.ExpiresAt.After(now) {
+			continue
+		}
+		if !found || e.RevokedAt.After(latest) {
+			latest, found = e.RevokedAt, true
+		}
+	}
+	return latest, found, nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryIdentityRepository struct {
+	mu         sync.Mutex
+	identities []models.UserIdentity
+}
+
+// NewMemoryIdentityRepository returns an empty, thread-safe in-memory
+// IdentityRepository.
+func NewMemoryIdentityRepository() IdentityRepository {
+	return &memoryIdentityRepository{}
+}
+
+func (r *memoryIdentityRepository) Create(ctx context.Context, identity models.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.identities {
+		if i.Provider == identity.Provider && (i.Subject == identity.Subject || i.UserID == identity.UserID) {
+			return ErrDuplicate
+		}
+	}
+	identity.ID = primitive.NewObjectID()
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *memoryIdentityRepository) Get(ctx context.Context, provider, subject string) (models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return models.UserIdentity{}, ErrNotFound
+}
+
+func (r *memoryIdentityRepository) ListForUser(ctx context.Context, userID string) ([]models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identities := []models.UserIdentity{}
+	for _, i := range r.identities {
+		if i.UserID == userID {
+			identities = append(identities, i)
+		}
+	}
+	sort.Slice(identities, func(a, b int) bool { return identities[a].Provider < identities[b].Provider })
+	return identities, nil
+}
+
+func (r *memoryIdentityRepository) Delete(ctx context.Context, userID, provider string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for n, i := range r.identities {
+		if i.UserID == userID && i.Provider == provider {
+			r.identities = append(r.identities[:n], r.identities[n+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryIdentityRepository) RecordLogin(ctx context.Context, provider, subject string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for n := range r.identities {
+		if r.identities[n].Provider == provider && r.identities[n].Subject == subject {
+			r.identities[n].LastLoginAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *memoryIdentityRepository) EraseUser(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.identities[:0]
+	for _, i := range r.identities {
+		if i.UserID != userID {
+			kept = append(kept, i)
+		}
+	}
+	r.identities = kept
+	return nil
+}
+
+type memoryOIDCFlowRepository struct {
+	mu    sync.Mutex
+	flows map[string]models.OIDCFlow // keyed by state hash
+}
+
+// NewMemoryOIDCFlowRepository returns an empty, thread-safe in-memory
+// OIDCFlowRepository.
+func NewMemoryOIDCFlowRepository() OIDCFlowRepository {
+	return &memoryOIDCFlowRepository{flows: map[string]models.OIDCFlow{}}
+}
+
+func (r *memoryOIDCFlowRepository) Create(ctx context.Context, flow models.OIDCFlow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.flows[flow.StateHash]; ok {
+		return ErrDuplicate
+	}
+	r.flows[flow.StateHash] = flow
+	return nil
+}
+
+func (r *memoryOIDCFlowRepository) Consume(ctx context.Context, stateHash string, now time.Time) (models.OIDCFlow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flow, ok := r.flows[stateHash]
+	if !ok {
+		return models.OIDCFlow{}, ErrNotFound
+	}
+	delete(r.flows, stateHash)
+	if !now.Before(flow.ExpiresAt) {
+		return models.OIDCFlow{}, ErrNotFound
+	}
+	return flow, nil
+}
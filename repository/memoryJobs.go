@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/utils"
+)
+
+type memoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]models.Job
+}
+
+// NewMemoryJobStore returns an empty, thread-safe in-memory utils.JobStore.
+func NewMemoryJobStore() utils.JobStore {
+	return &memoryJobStore{jobs: map[string]models.Job{}}
+}
+
+func cloneJob(j models.Job) models.Job {
+	j.Payload = maps.Clone(j.Payload)
+	j.Result = maps.Clone(j.Result)
+	if j.LockedUntil != nil {
+		t := *j.LockedUntil
+		j.LockedUntil = &t
+	}
+	if j.FinishedAt != nil {
+		t := *j.FinishedAt
+		j.FinishedAt = &t
+	}
+	if j.Progress != nil {
+		p := *j.Progress
+		p.Counts = maps.Clone(p.Counts)
+		j.Progress = &p
+	}
+	return j
+}
+
+func (s *memoryJobStore) CreateJob(ctx context.Context, job models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.JobID]; ok {
+		return ErrDuplicate
+	}
+	s.jobs[job.JobID] = cloneJob(job)
+	return nil
+}
+
+func (s *memoryJobStore) GetJob(ctx context.Context, jobID string) (models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return models.Job{}, ErrNotFound
+	}
+	return cloneJob(job), nil
+}
+
+func (s *memoryJobStore) ListJobs(ctx context.Context, filter utils.JobFilter) ([]models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := []models.Job{}
+	for _, j := range s.jobs {
+		if (filter.Type == "" || j.Type == filter.Type) && (filter.Status == "" || j.Status == filter.Status) {
+			jobs = append(jobs, cloneJob(j))
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].CreatedAt.After(jobs[b].CreatedAt) })
+	if filter.Limit > 0 && len(jobs) > filter.Limit {
+		jobs = jobs[:filter.Limit]
+	}
+	return jobs, nil
+}
+
+func (s *memoryJobStore) ClaimJob(ctx context.Context, worker string, now time.Time, lease time.Duration) (models.Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next *models.Job
+	for id := range s.jobs {
+		j := s.jobs[id]
+		due := (j.Status == models.JobQueued && !j.RunAt.After(now)) ||
+			(j.Status == models.JobRunning && j.LockedUntil != nil && j.LockedUntil.Before(now))
+		if due && (next == nil || j.RunAt.Before(next.RunAt)) {
+			next = &j
+		}
+	}
+	if next == nil {
+		return models.Job{}, false, nil
+	}
+	until := now.Add(lease)
+	next.Status, next.LockedBy, next.LockedUntil = models.JobRunning, worker, &until
+	next.Attempts++
+	next.UpdatedAt = now
+	s.jobs[next.JobID] = *next
+	return cloneJob(*next), true, nil
+}
+
+// update applies fn to a job worker still holds.
+func (s *memoryJobStore) update(jobID, worker string, fn func(j *models.Job)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[jobID]
+	if !ok || j.Status != models.JobRunning || j.LockedBy != worker {
+		return ErrNotFound
+	}
+	fn(&j)
+	s.jobs[jobID] = j
+	return nil
+}
+
+// finish releases a job worker still holds after applying fn.
+func (s *memoryJobStore) finish(jobID, worker string, fn func(j *models.Job)) error {
+	return s.update(jobID, worker, func(j *models.Job) {
+		fn(j)
+		j.LockedBy, j.LockedUntil = "", nil
+	})
+}
+
+func (s *memoryJobStore) ExtendJobLease(ctx context.Context, jobID, worker string, until time.Time) error {
+	return s.update(jobID, worker, func(j *models.Job) { j.LockedUntil = &until })
+}
+
+func (s *memoryJobStore) SetJobProgress(ctx context.Context, jobID, worker string, progress models.JobProgress) error {
+	progress.Counts = maps.Clone(progress.Counts)
+	return s.update(jobID, worker, func(j *models.Job) {
+		j.Progress, j.UpdatedAt = &progress, time.Now()
+	})
+}
+
+func (s *memoryJobStore) CompleteJob(ctx context.Context, jobID, worker string, result map[string]string, now time.Time) error {
+	return s.finish(jobID, worker, func(j *models.Job) {
+		j.Status, j.Result = models.JobSucceeded, maps.Clone(result)
+		j.UpdatedAt, j.FinishedAt = now, &now
+	})
+}
+
+func (s *memoryJobStore) RetryJob(ctx context.Context, jobID, worker, lastErr string, runAt, now time.Time) error {
+	return s.finish(jobID, worker, func(j *models.Job) {
+		j.Status, j.LastError, j.RunAt, j.UpdatedAt = models.JobQueued, lastErr, runAt, now
+	})
+}
+
+func (s *memoryJobStore) BuryJob(ctx context.Context, jobID, worker, lastErr string, now time.Time) error {
+	return s.finish(jobID, worker, func(j *models.Job) {
+		j.Status, j.LastError = models.JobDead, lastErr
+		j.UpdatedAt, j.FinishedAt = now, &now
+	})
+}
+
+func (s *memoryJobStore) RequeueJob(ctx context.Context, jobID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[jobID]
+	if !ok || j.Status != models.JobDead {
+		return ErrNotFound
+	}
+	j.Status, j.Attempts, j.RunAt, j.UpdatedAt = models.JobQueued, 0, now, now
+	j.FinishedAt, j.CallbackStatus = nil, ""
+	s.jobs[jobID] = j
+	return nil
+}
+
+func (s *memoryJobStore) SetJobCallbackStatus(ctx context.Context, jobID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j, ok := s.jobs[jobID]; ok {
+		j.CallbackStatus = status
+		s.jobs[jobID] = j
+	}
+	return nil
+}
+
+func (s *memoryJobStore) EraseUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, j := range s.jobs {
+		if j.CreatedBy == userID {
+			j.CreatedBy = ""
+			s.jobs[id] = j
+		}
+	}
+	return nil
+}
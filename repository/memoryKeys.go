@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/utils"
+)
+
+type memoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]models.SigningKey
+}
+
+// NewMemoryKeyStore returns an empty, thread-safe in-memory utils.KeyStore.
+// Tokens do not survive a restart with it.
+func NewMemoryKeyStore() utils.KeyStore {
+	return &memoryKeyStore{keys: map[string]models.SigningKey{}}
+}
+
+func (s *memoryKeyStore) LoadKeys(ctx context.Context) ([]models.SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]models.SigningKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (s *memoryKeyStore) SaveKey(ctx context.Context, key models.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.KeyID] = key
+	return nil
+}
+
+func (s *memoryKeyStore) DeleteKey(ctx context.Context, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, keyID)
+	return nil
+}
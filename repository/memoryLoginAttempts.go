@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempt
+}
+
+// NewMemoryLoginAttemptRepository returns an empty, thread-safe in-memory
+// LoginAttemptRepository. Expired counters are pruned whenever a failure is
+// recorded.
+func NewMemoryLoginAttemptRepository() LoginAttemptRepository {
+	return &memoryLoginAttemptRepository{attempts: map[string]LoginAttempt{}}
+}
+
+func (r *memoryLoginAttemptRepository) Get(ctx context.Context, keys []string) ([]LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var attempts []LoginAttempt
+	for _, key := range keys {
+		if a, ok := r.attempts[key]; ok && a.ExpiresAt.After(now) {
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts, nil
+}
+
+func (r *memoryLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at, expiresAt time.Time) (LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, a := range r.attempts {
+		if !a.ExpiresAt.After(at) {
+			delete(r.attempts, k)
+		}
+	}
+
+	previous := r.attempts[key]
+	previous.Key = key
+	a := previous
+	a.Failures++
+	a.LastFailureAt = at
+	a.ExpiresAt = expiresAt
+	r.attempts[key] = a
+	return previous, nil
+}
+
+func (r *memoryLoginAttemptRepository) Forgive(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if a, ok := r.attempts[key]; ok && a.Failures > 0 {
+		a.Failures--
+		r.attempts[key] = a
+	}
+	return nil
+}
+
+func (r *memoryLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
+
+func (r *memoryLoginAttemptRepository) EraseEmail(ctx context.Context, email string) error {
+	return r.Reset(ctx, AccountAttemptKey(email))
+}
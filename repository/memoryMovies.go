@@ -0,0 +1,422 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryMovieRepository struct {
+	mu     sync.RWMutex
+	movies []models.Movie // in insertion order
+}
+
+// NewMemoryMovieRepository returns an empty, thread-safe in-memory
+// MovieRepository.
+func NewMemoryMovieRepository() MovieRepository {
+	return &memoryMovieRepository{}
+}
+
+func cloneMovie(m models.Movie) models.Movie {
+	if m.Genres != nil {
+		m.Genres = append([]models.Genre(nil), m.Genres...)
+	}
+	if m.DeletedAt != nil {
+		t := *m.DeletedAt
+		m.DeletedAt = &t
+	}
+	return m
+}
+
+func matchesMovieFilter(m models.Movie, f MovieFilter) bool {
+	if m.DeletedAt != nil {
+		return false
+	}
+	if len(f.GenreNames) > 0 && !hasGenre(m, func(g models.Genre) bool { return containsString(f.GenreNames, g.GenreName) }) {
+		return false
+	}
+	if len(f.GenreIDs) > 0 && !hasGenre(m, func(g models.Genre) bool { return containsInt(f.GenreIDs, g.GenreID) }) {
+		return false
+	}
+	if f.RankingMin != nil && m.Ranking.RankingValue < *f.RankingMin {
+		return false
+	}
+	if f.RankingMax != nil && m.Ranking.RankingValue > *f.RankingMax {
+		return false
+	}
+	if f.TitlePrefix != "" && !strings.HasPrefix(strings.ToLower(m.Title), strings.ToLower(f.TitlePrefix)) {
+		return false
+	}
+	return true
+}
+
+func hasGenre(m models.Movie, match func(models.Genre) bool) bool {
+	for _, g := range m.Genres {
+		if match(g) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// compareMovies orders a and b by the sort key, then by ID.
+func compareMovies(a, b models.Movie, sortKey string) int {
+	switch sortKey {
+	case SortTitle:
+		if c := strings.Compare(a.Title, b.Title); c != 0 {
+			return c
+		}
+	case SortRanking:
+		if a.Ranking.RankingValue != b.Ranking.RankingValue {
+			if a.Ranking.RankingValue < b.Ranking.RankingValue {
+				return -1
+			}
+			return 1
+		}
+	}
+	return bytes.Compare(a.ID[:], b.ID[:])
+}
+
+func (r *memoryMovieRepository) matching(f MovieFilter) []models.Movie {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []models.Movie
+	for _, m := range r.movies {
+		if matchesMovieFilter(m, f) {
+			out = append(out, cloneMovie(m))
+		}
+	}
+	return out
+}
+
+func (r *memoryMovieRepository) List(ctx context.Context, q MovieQuery) (MoviePage, error) {
+	if _, ok := mongoSortFields[q.Sort]; !ok {
+		q.Sort = SortCreated
+	}
+	movies := r.matching(q.Filter)
+	page := MoviePage{Total: int64(len(movies))}
+
+	less := func(a, b models.Movie) bool {
+		c := compareMovies(a, b, q.Sort)
+		if q.Desc {
+			c = -c
+		}
+		return c < 0
+	}
+	sort.SliceStable(movies, func(i, j int) bool { return less(movies[i], movies[j]) })
+
+	switch {
+	case q.Cursor == nil:
+		movies = movies[min(q.Skip, len(movies)):]
+	case q.Cursor.Before:
+		pivot := cursorMovie(q.Cursor)
+		var before []models.Movie
+		for _, m := range movies {
+			if less(m, pivot) {
+				before = append(before, m)
+			}
+		}
+		page.HasMore = len(before) > q.Limit
+		page.Movies = before[max(len(before)-q.Limit, 0):]
+		return page, nil
+	default:
+		pivot := cursorMovie(q.Cursor)
+		var after []models.Movie
+		for _, m := range movies {
+			if less(pivot, m) {
+				after = append(after, m)
+			}
+		}
+		movies = after
+	}
+
+	page.HasMore = len(movies) > q.Limit
+	page.Movies = movies[:min(q.Limit, len(movies))]
+	return page, nil
+}
+
+// cursorMovie builds a movie holding the cursor's sort values, so it can be
+// compared with compareMovies.
+func cursorMovie(cur *MovieCursor) models.Movie {
+	return models.Movie{
+		ID:      cur.ID,
+		Title:   cur.Title,
+		Ranking: models.Ranking{RankingValue: cur.Ranking},
+	}
+}
+
+func (r *memoryMovieRepository) Each(ctx context.Context, filter MovieFilter, fn func(models.Movie) error) error {
+	for _, m := range r.matching(filter) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TextSearch approximates a MongoDB text index: every exact word match in the
+// title counts 10 and in the review 3, mirroring the index weights.
+func (r *memoryMovieRepository) TextSearch(ctx context.Context, filter MovieFilter, text string, limit int) ([]ScoredMovie, error) {
+	terms := utils.Tokenize(text)
+
+	var hits []ScoredMovie
+	for _, m := range r.matching(filter) {
+		score := 10*countTerms(m.Title, terms) + 3*countTerms(m.AdminReview, terms)
+		if score > 0 {
+			hits = append(hits, ScoredMovie{Movie: m, Score: float64(score)})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func countTerms(text string, terms []string) int {
+	n := 0
+	for _, w := range utils.Tokenize(text) {
+		if containsString(terms, w) {
+			n++
+		}
+	}
+	return n
+}
+
+// find returns the index of the movie with imdbID, optionally including
+// soft-deleted ones. The caller must hold the lock.
+func (r *memoryMovieRepository) find(imdbID string, deleted bool) int {
+	for i, m := range r.movies {
+		if m.ImdbID == imdbID && (deleted || m.DeletedAt == nil) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *memoryMovieRepository) Get(ctx context.Context, imdbID string) (models.Movie, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.find(imdbID, false)
+	if i < 0 {
+		return models.Movie{}, ErrNotFound
+	}
+	return cloneMovie(r.movies[i]), nil
+}
+
+func (r *memoryMovieRepository) Create(ctx context.Context, movie models.Movie) (models.Movie, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Soft-deleted movies still hold their IMDb ID, as with the unique index.
+	if r.find(movie.ImdbID, true) >= 0 {
+		return movie, ErrDuplicate
+	}
+	movie = cloneMovie(movie)
+	movie.ID = primitive.NewObjectID()
+	movie.DeletedAt = nil
+	r.movies = append(r.movies, movie)
+	return cloneMovie(movie), nil
+}
+
+func (r *memoryMovieRepository) Update(ctx context.Context, imdbID string, patch MoviePatch) (models.Movie, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(imdbID, false)
+	if i < 0 {
+		return models.Movie{}, ErrNotFound
+	}
+	m := &r.movies[i]
+	if patch.Title != nil {
+		m.Title = *patch.Title
+	}
+	if patch.PosterPath != nil {
+		m.PosterPath = *patch.PosterPath
+	}
+	if patch.YouTubeID != nil {
+		m.YouTubeID = *patch.YouTubeID
+	}
+	if patch.Genres != nil {
+		m.Genres = append([]models.Genre(nil), (*patch.Genres)...)
+	}
+	return cloneMovie(*m), nil
+}
+
+func (r *memoryMovieRepository) SetReview(ctx context.Context, imdbID, review string, ranking models.Ranking) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(imdbID, false)
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.movies[i].AdminReview = review
+	r.movies[i].Ranking = ranking
+	r.movies[i].RankingStatus, r.movies[i].RankingJobID = "", ""
+	return nil
+}
+
+func (r *memoryMovieRepository) SetReviewPending(ctx context.Context, imdbID, review, jobID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(imdbID, false)
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.movies[i].AdminReview = review
+	r.movies[i].RankingStatus, r.movies[i].RankingJobID = models.RankingPending, jobID
+	return nil
+}
+
+func (r *memoryMovieRepository) FinishRanking(ctx context.Context, imdbID, jobID string, ranking models.Ranking) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(imdbID, false)
+	if i < 0 || r.movies[i].RankingJobID != jobID {
+		return ErrNotFound
+	}
+	r.movies[i].Ranking = ranking
+	r.movies[i].RankingStatus = models.RankingRanked
+	return nil
+}
+
+func (r *memoryMovieRepository) FailRanking(ctx context.Context, imdbID, jobID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(imdbID, false)
+	if i < 0 || r.movies[i].RankingJobID != jobID {
+		return ErrNotFound
+	}
+	r.movies[i].RankingStatus = models.RankingFailed
+	return nil
+}
+
+func (r *memoryMovieRepository) Rerank(ctx context.Context, imdbID, review string, ranking models.Ranking) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(imdbID, false)
+	if i < 0 || r.movies[i].AdminReview != review || r.movies[i].RankingStatus == models.RankingPending {
+		return ErrNotFound
+	}
+	r.movies[i].Ranking = ranking
+	r.movies[i].RankingStatus, r.movies[i].RankingJobID = "", ""
+	return nil
+}
+
+func (r *memoryMovieRepository) SoftDelete(ctx context.Context, imdbID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(imdbID, false)
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.movies[i].DeletedAt = &at
+	return nil
+}
+
+func (r *memoryMovieRepository) Restore(ctx context.Context, imdbID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.movies {
+		if r.movies[i].ImdbID == imdbID && r.movies[i].DeletedAt != nil {
+			r.movies[i].DeletedAt = nil
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryMovieRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.movies[:0]
+	var purged int64
+	for _, m := range r.movies {
+		if m.DeletedAt != nil && !m.DeletedAt.After(deletedBefore) {
+			purged++
+			continue
+		}
+		kept = append(kept, m)
+	}
+	r.movies = kept
+	return purged, nil
+}
+
+func (r *memoryMovieRepository) ExistingImdbIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	existing := map[string]bool{}
+	for _, id := range ids {
+		if i := r.find(id, true); i >= 0 {
+			existing[id] = r.movies[i].DeletedAt != nil
+		}
+	}
+	return existing, nil
+}
+
+func (r *memoryMovieRepository) BulkUpsert(ctx context.Context, movies []models.Movie) ([]UpsertResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]UpsertResult, len(movies))
+	for n, movie := range movies {
+		movie = cloneMovie(movie)
+		if i := r.find(movie.ImdbID, true); i >= 0 {
+			m := &r.movies[i]
+			if m.DeletedAt != nil {
+				results[n].Err = ErrMovieDeleted
+				continue
+			}
+			m.Title, m.PosterPath, m.YouTubeID = movie.Title, movie.PosterPath, movie.YouTubeID
+			m.Genres, m.AdminReview, m.Ranking = movie.Genres, movie.AdminReview, movie.Ranking
+			m.RankingStatus, m.RankingJobID = "", ""
+			continue
+		}
+		movie.ID = primitive.NewObjectID()
+		movie.DeletedAt = nil
+		r.movies = append(r.movies, movie)
+		results[n].Inserted = true
+	}
+	return results, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/samrato/magicstream/models"
+)
+
+type memoryRerankRepository struct {
+	mu      sync.RWMutex
+	changes map[string]models.RerankChange
+}
+
+// NewMemoryRerankRepository returns an empty, thread-safe in-memory
+// RerankRepository.
+func NewMemoryRerankRepository() RerankRepository {
+	return &memoryRerankRepository{changes: map[string]models.RerankChange{}}
+}
+
+func cloneRerankChange(c models.RerankChange) models.RerankChange {
+	if c.NewRanking != nil {
+		r := *c.NewRanking
+		c.NewRanking = &r
+	}
+	return c
+}
+
+func (r *memoryRerankRepository) Record(ctx context.Context, change models.RerankChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	change.ID = change.RunID + "/" + change.ImdbID
+	r.changes[change.ID] = cloneRerankChange(change)
+	return nil
+}
+
+func (r *memoryRerankRepository) List(ctx context.Context, runID string, filter RerankFilter) ([]models.RerankChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	changes := []models.RerankChange{}
+	for _, c := range r.changes {
+		if c.RunID == runID && (filter.Outcome == "" || c.Outcome == filter.Outcome) {
+			changes = append(changes, cloneRerankChange(c))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ImdbID < changes[j].ImdbID })
+	if filter.Skip >= len(changes) {
+		return []models.RerankChange{}, nil
+	}
+	changes = changes[filter.Skip:]
+	if filter.Limit > 0 && len(changes) > filter.Limit {
+		changes = changes[:filter.Limit]
+	}
+	return changes, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/utils"
+)
+
+type memoryRoleStore struct {
+	mu    sync.RWMutex
+	roles map[string]models.Role
+}
+
+// NewMemoryRoleStore returns an empty, thread-safe in-memory utils.RoleStore.
+func NewMemoryRoleStore() utils.RoleStore {
+	return &memoryRoleStore{roles: map[string]models.Role{}}
+}
+
+func cloneRole(r models.Role) models.Role {
+	r.Permissions = append([]string{}, r.Permissions...)
+	return r
+}
+
+func (s *memoryRoleStore) LoadRoles(ctx context.Context) ([]models.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]models.Role, 0, len(s.roles))
+	for _, r := range s.roles {
+		roles = append(roles, cloneRole(r))
+	}
+	return roles, nil
+}
+
+func (s *memoryRoleStore) SaveRole(ctx context.Context, role models.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roles[role.Name] = cloneRole(role)
+	return nil
+}
+
+func (s *memoryRoleStore) DeleteRole(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[name]; !ok {
+		return ErrNotFound
+	}
+	delete(s.roles, name)
+	return nil
+}
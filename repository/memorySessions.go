@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+type memorySessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]models.Session // keyed by session ID
+}
+
+// NewMemorySessionRepository returns an empty, thread-safe in-memory
+// SessionRepository. Expired sessions are kept until the process exits.
+func NewMemorySessionRepository() SessionRepository {
+	return &memorySessionRepository{sessions: map[string]models.Session{}}
+}
+
+func cloneSession(s models.Session) models.Session {
+	if s.RevokedAt != nil {
+		t := *s.RevokedAt
+		s.RevokedAt = &t
+	}
+	return s
+}
+
+func (r *memorySessionRepository) Create(ctx context.Context, session models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[session.SessionID]; ok {
+		return ErrDuplicate
+	}
+	r.sessions[session.SessionID] = cloneSession(session)
+	return nil
+}
+
+func (r *memorySessionRepository) Get(ctx context.Context, sessionID string) (models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.sessions[sessionID]
+	if !ok {
+		return models.Session{}, ErrNotFound
+	}
+	return cloneSession(s), nil
+}
+
+func (r *memorySessionRepository) ListActive(ctx context.Context, userID string) ([]models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	sessions := []models.Session{}
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.Active(now) {
+			sessions = append(sessions, cloneSession(s))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) Rotate(ctx context.Context, sessionID, oldRefreshID, newRefreshID string, usedAt, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[sessionID]
+	if !ok || !s.Active(usedAt) || s.RefreshID != oldRefreshID {
+		return ErrNotFound
+	}
+	s.RefreshID, s.LastUsedAt, s.ExpiresAt = newRefreshID, usedAt, expiresAt
+	r.sessions[sessionID] = s
+	return nil
+}
+
+func (r *memorySessionRepository) Revoke(ctx context.Context, sessionID, reason string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[sessionID]
+	if !ok || s.RevokedAt != nil {
+		return ErrNotFound
+	}
+	s.RevokedAt, s.RevokedReason = &at, reason
+	r.sessions[sessionID] = s
+	return nil
+}
+
+func (r *memorySessionRepository) RevokeAll(ctx context.Context, userID, reason string, at time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for id, s := range r.sessions {
+		if s.UserID == userID && s.Active(at) {
+			revokedAt := at
+			s.RevokedAt, s.RevokedReason = &revokedAt, reason
+			r.sessions[id] = s
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memorySessionRepository) EraseUser(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, s := range r.sessions {
+		if s.UserID == userID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+type memoryUserTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]models.UserToken // keyed by token hash
+}
+
+// NewMemoryUserTokenRepository returns an empty, thread-safe in-memory
+// UserTokenRepository.
+func NewMemoryUserTokenRepository() UserTokenRepository {
+	return &memoryUserTokenRepository{tokens: map[string]models.UserToken{}}
+}
+
+func (r *memoryUserTokenRepository) Create(ctx context.Context, token models.UserToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[token.TokenHash]; ok {
+		return ErrDuplicate
+	}
+	r.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *memoryUserTokenRepository) Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenHash]
+	if !ok || token.Purpose != purpose || !now.Before(token.ExpiresAt) {
+		return models.UserToken{}, ErrNotFound
+	}
+	delete(r.tokens, tokenHash)
+	return token, nil
+}
+
+func (r *memoryUserTokenRepository) Latest(ctx context.Context, userID, purpose string) (models.UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var latest models.UserToken
+	found := false
+	for _, t := range r.tokens {
+		if t.UserID == userID && t.Purpose == purpose && (!found || t.CreatedAt.After(latest.CreatedAt)) {
+			latest, found = t, true
+		}
+	}
+	if !found {
+		return latest, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *memoryUserTokenRepository) DeleteForUser(ctx context.Context, userID, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, t := range r.tokens {
+		if t.UserID == userID && t.Purpose == purpose {
+			delete(r.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (r *memoryUserTokenRepository) EraseUser(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, t := range r.tokens {
+		if t.UserID == userID {
+			delete(r.tokens, hash)
+		}
+	}
+	return nil
+}
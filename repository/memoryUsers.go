@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users []models.User
+}
+
+// NewMemoryUserRepository returns an empty, thread-safe in-memory
+// UserRepository.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{}
+}
+
+func cloneUser(u models.User) models.User {
+	if u.FavouriteGenres != nil {
+		u.FavouriteGenres = append([]models.Genre(nil), u.FavouriteGenres...)
+	}
+	u.EmailVerifiedAt = cloneTime(u.EmailVerifiedAt)
+	u.DisabledAt = cloneTime(u.DisabledAt)
+	u.DeletedAt = cloneTime(u.DeletedAt)
+	u.AnonymisedAt = cloneTime(u.AnonymisedAt)
+	u.MFA = cloneMFA(u.MFA)
+	return u
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := *t
+	return &v
+}
+
+// find returns the index of the first user matching fn. The caller must hold
+// the lock.
+func (r *memoryUserRepository) find(fn func(models.User) bool) int {
+	for i, u := range r.users {
+		if fn(u) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user models.User) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.find(func(u models.User) bool { return u.Email == user.Email || u.UserID == user.UserID }) >= 0 {
+		return user, ErrDuplicate
+	}
+	user = cloneUser(user)
+	user.ID = primitive.NewObjectID()
+	r.users = append(r.users, user)
+	return cloneUser(user), nil
+}
+
+func (r *memoryUserRepository) get(fn func(models.User) bool) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.find(fn)
+	if i < 0 {
+		return models.User{}, ErrNotFound
+	}
+	return cloneUser(r.users[i]), nil
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.get(func(u models.User) bool { return u.Email == email })
+}
+
+func (r *memoryUserRepository) GetByUserID(ctx context.Context, userID string) (models.User, error) {
+	return r.get(func(u models.User) bool { return u.UserID == userID })
+}
+
+func (r *memoryUserRepository) UpdateFavouriteGenres(ctx context.Context, userID string, genres []models.Genre) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.users[i].FavouriteGenres = append([]models.Genre(nil), genres...)
+	r.users[i].UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryUserRepository) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.users[i].Password = passwordHash
+	r.users[i].UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryUserRepository) MarkEmailVerified(ctx context.Context, userID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.users[i].EmailVerified = true
+	r.users[i].EmailVerifiedAt = &at
+	r.users[i].UpdatedAt = at
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateProfile(ctx context.Context, userID string, patch UserPatch) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID && u.DeletedAt == nil })
+	if i < 0 {
+		return models.User{}, ErrNotFound
+	}
+	if patch.FirstName != nil {
+		r.users[i].FirstName = *patch.FirstName
+	}
+	if patch.LastName != nil {
+		r.users[i].LastName = *patch.LastName
+	}
+	r.users[i].UpdatedAt = time.Now()
+	return cloneUser(r.users[i]), nil
+}
+
+func (r *memoryUserRepository) SoftDelete(ctx context.Context, userID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID && u.DeletedAt == nil })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.users[i].DeletedAt = &at
+	r.users[i].UpdatedAt = at
+	return nil
+}
+
+func (r *memoryUserRepository) DeletedBefore(ctx context.Context, cutoff time.Time) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []models.User
+	for _, u := range r.users {
+		if u.DeletedAt != nil && !u.DeletedAt.After(cutoff) && u.AnonymisedAt == nil {
+			users = append(users, cloneUser(u))
+		}
+	}
+	return users, nil
+}
+
+func (r *memoryUserRepository) Anonymise(ctx context.Context, userID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID && u.DeletedAt != nil })
+	if i < 0 {
+		return ErrNotFound
+	}
+	u := &r.users[i]
+	u.FirstName, u.LastName = "Deleted", "User"
+	u.Email = AnonymousEmail(userID)
+	u.Password, u.Token, u.RefreshToken = "", "", ""
+	u.FavouriteGenres = []models.Genre{}
+	u.EmailVerifiedAt = nil
+	u.MFA = nil
+	u.AnonymisedAt = &at
+	u.UpdatedAt = at
+	return nil
+}
+
+func matchesUserFilter(u models.User, f UserFilter) bool {
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		if !strings.Contains(strings.ToLower(u.FirstName), search) &&
+			!strings.Contains(strings.ToLower(u.LastName), search) &&
+			!strings.Contains(strings.ToLower(u.Email), search) {
+			return false
+		}
+	}
+	if f.Role != "" && u.Role != f.Role {
+		return false
+	}
+	switch f.Status {
+	case UserStatusActive:
+		return !u.Disabled && u.DeletedAt == nil
+	case UserStatusDisabled:
+		return u.Disabled && u.DeletedAt == nil
+	case UserStatusDeleted:
+		return u.DeletedAt != nil
+	}
+	return true
+}
+
+func (r *memoryUserRepository) List(ctx context.Context, q UserQuery) (UserPage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Newest first; users are stored in insertion order
+	matched := []models.User{}
+	for i := len(r.users) - 1; i >= 0; i-- {
+		if matchesUserFilter(r.users[i], q.Filter) {
+			matched = append(matched, r.users[i])
+		}
+	}
+
+	page := UserPage{Total: int64(len(matched)), Users: []models.User{}}
+	matched = matched[min(q.Skip, len(matched)):]
+	for _, u := range matched[:min(q.Limit, len(matched))] {
+		page.Users = append(page.Users, cloneUser(u))
+	}
+	return page, nil
+}
+
+func (r *memoryUserRepository) SetRole(ctx context.Context, userID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.users[i].Role = role
+	r.users[i].UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryUserRepository) SetDisabled(ctx context.Context, userID string, disabled bool, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.users[i].Disabled = disabled
+	r.users[i].DisabledAt = nil
+	if disabled {
+		r.users[i].DisabledAt = &at
+	}
+	r.users[i].UpdatedAt = at
+	return nil
+}
+
+func cloneMFA(m *models.UserMFA) *models.UserMFA {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	c.EnabledAt = cloneTime(m.EnabledAt)
+	c.RecoveryCodes = append([]string(nil), m.RecoveryCodes...)
+	return &c
+}
+
+func (r *memoryUserRepository) SetMFA(ctx context.Context, userID string, mfa *models.UserMFA) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.users[i].MFA = cloneMFA(mfa)
+	r.users[i].UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryUserRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID })
+	if i < 0 || r.users[i].MFA == nil || r.users[i].MFA.LastUsedStep >= step {
+		return ErrNotFound
+	}
+	r.users[i].MFA.LastUsedStep = step
+	return nil
+}
+
+func (r *memoryUserRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(func(u models.User) bool { return u.UserID == userID })
+	if i < 0 || r.users[i].MFA == nil {
+		return ErrNotFound
+	}
+	codes := r.users[i].MFA.RecoveryCodes
+	for n, h := range codes {
+		if h == codeHash {
+			r.users[i].MFA.RecoveryCodes = append(codes[:n:n], codes[n+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
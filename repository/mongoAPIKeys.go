@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAPIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAPIKeyRepository returns an APIKeyRepository backed by collection.
+// A unique index on key_hash serves the lookup on every request.
+func NewMongoAPIKeyRepository(collection *mongo.Collection) APIKeyRepository {
+	return &mongoAPIKeyRepository{collection: collection}
+}
+
+func (r *mongoAPIKeyRepository) Create(ctx context.Context, key models.APIKey) error {
+	_, err := r.collection.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoAPIKeyRepository) findOne(ctx context.Context, filter bson.M) (models.APIKey, error) {
+	var key models.APIKey
+	err := r.collection.FindOne(ctx, filter).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return key, ErrNotFound
+	}
+	return key, err
+}
+
+func (r *mongoAPIKeyRepository) Get(ctx context.Context, keyID string) (models.APIKey, error) {
+	return r.findOne(ctx, bson.M{"_id": keyID})
+}
+
+func (r *mongoAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	return r.findOne(ctx, bson.M{"key_hash": keyHash})
+}
+
+func (r *mongoAPIKeyRepository) List(ctx context.Context, userID string) ([]models.APIKey, error) {
+	filter := bson.M{}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *mongoAPIKeyRepository) Revoke(ctx context.Context, keyID string, at time.Time) error {
+	res, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": keyID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": at}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoAPIKeyRepository) RecordUse(ctx context.Context, keyID string, at time.Time, ip string) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": keyID},
+		bson.M{"$set": bson.M{"last_used_at": at, "last_used_ip": ip}})
+	return err
+}
+
+func (r *mongoAPIKeyRepository) EraseUser(ctx context.Context, userID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
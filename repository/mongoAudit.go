@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAuditRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAuditRepository returns an AuditRepository backed by collection.
+func NewMongoAuditRepository(collection *mongo.Collection) AuditRepository {
+	return &mongoAuditRepository{collection: collection}
+}
+
+func (r *mongoAuditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	entry.ID = primitive.NilObjectID
+	_, err := r.collection.InsertOne(ctx, entry)
+	return err
+}
+
+func (r *mongoAuditRepository) ListForTarget(ctx context.Context, targetType, targetID string, limit int) ([]models.AuditEntry, error) {
+	filter := bson.M{"target_type": targetType, "target_id": targetID}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
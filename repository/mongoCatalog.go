@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoGenreRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoGenreRepository returns a GenreRepository backed by collection.
+func NewMongoGenreRepository(collection *mongo.Collection) GenreRepository {
+	return &mongoGenreRepository{collection: collection}
+}
+
+func (r *mongoGenreRepository) List(ctx context.Context) ([]models.Genre, error) {
+	var genres []models.Genre
+	err := findAll(ctx, r.collection, &genres)
+	return genres, err
+}
+
+func (r *mongoGenreRepository) Each(ctx context.Context, fn func(models.Genre) error) error {
+	return each(ctx, r.collection, fn)
+}
+
+type mongoRankingRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRankingRepository returns a RankingRepository backed by collection.
+func NewMongoRankingRepository(collection *mongo.Collection) RankingRepository {
+	return &mongoRankingRepository{collection: collection}
+}
+
+func (r *mongoRankingRepository) List(ctx context.Context) ([]models.Ranking, error) {
+	var rankings []models.Ranking
+	err := findAll(ctx, r.collection, &rankings)
+	return rankings, err
+}
+
+func (r *mongoRankingRepository) Each(ctx context.Context, fn func(models.Ranking) error) error {
+	return each(ctx, r.collection, fn)
+}
+
+// ========================== HELPERS ==========================
+
+func findAll(ctx context.Context, collection *mongo.Collection, out interface{}) error {
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, out)
+}
+
+// each decodes every document of collection into T and passes it to fn.
+func each[T any](ctx context.Context, collection *mongo.Collection, fn func(T) error) error {
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoDenylistRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoDenylistRepository returns a DenylistRepository backed by
+// collection. A TTL index on expires_at removes stale entries.
+func NewMongoDenylistRepository(collection *mongo.Collection) DenylistRepository {
+	return &mongoDenylistRepository{collection: collection}
+}
+
+func (r *mongoDenylistRepository) Add(ctx context.Context, entry DenylistEntry) error {
+	update := bson.M{
+		"$set": bson.M{"reason": entry.Reason},
+		"$max": bson.M{"revoked_at": entry.RevokedAt, "expires_at": entry.ExpiresAt},
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": entry.Key}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *mongoDenylistRepository) LatestRevocation(ctx context.Context, keys []string) (time.Time, bool, error) {
+	// The TTL monitor only runs once a minute, so filter on expiry as well
+	filter := bson.M{"_id": bson.M{"$in": keys}, "expires_at": bson.M{"$gt": time.Now()}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "revoked_at", Value: -1}})
+
+	var entry DenylistEntry
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return entry.RevokedAt, true, nil
+}
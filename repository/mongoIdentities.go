@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoIdentityRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoIdentityRepository returns an IdentityRepository backed by
+// collection. Unique indexes on (provider, subject) and (user_id, provider)
+// keep links one to one.
+func NewMongoIdentityRepository(collection *mongo.Collection) IdentityRepository {
+	return &mongoIdentityRepository{collection: collection}
+}
+
+func (r *mongoIdentityRepository) Create(ctx context.Context, identity models.UserIdentity) error {
+	identity.ID = primitive.NilObjectID
+	_, err := r.collection.InsertOne(ctx, identity)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoIdentityRepository) Get(ctx context.Context, provider, subject string) (models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := r.collection.FindOne(ctx, bson.M{"provider": provider, "subject": subject}).Decode(&identity)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return identity, ErrNotFound
+	}
+	return identity, err
+}
+
+func (r *mongoIdentityRepository) ListForUser(ctx context.Context, userID string) ([]models.UserIdentity, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "provider", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	identities := []models.UserIdentity{}
+	if err := cursor.All(ctx, &identities); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (r *mongoIdentityRepository) Delete(ctx context.Context, userID, provider string) error {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"user_id": userID, "provider": provider})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoIdentityRepository) RecordLogin(ctx context.Context, provider, subject string, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"provider": provider, "subject": subject},
+		bson.M{"$set": bson.M{"last_login_at": at}})
+	return err
+}
+
+func (r *mongoIdentityRepository) EraseUser(ctx context.Context, userID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+type mongoOIDCFlowRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoOIDCFlowRepository returns an OIDCFlowRepository backed by
+// collection. A TTL index on expires_at removes abandoned flows.
+func NewMongoOIDCFlowRepository(collection *mongo.Collection) OIDCFlowRepository {
+	return &mongoOIDCFlowRepository{collection: collection}
+}
+
+func (r *mongoOIDCFlowRepository) Create(ctx context.Context, flow models.OIDCFlow) error {
+	flow.ID = primitive.NilObjectID
+	_, err := r.collection.InsertOne(ctx, flow)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoOIDCFlowRepository) Consume(ctx context.Context, stateHash string, now time.Time) (models.OIDCFlow, error) {
+	var flow models.OIDCFlow
+	err := r.collection.FindOneAndDelete(ctx, bson.M{"state_hash": stateHash, "expires_at": bson.M{"$gt": now}}).Decode(&flow)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return flow, ErrNotFound
+	}
+	return flow, err
+}
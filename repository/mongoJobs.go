@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoJobStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoJobStore returns a utils.JobStore backed by collection. Claims are
+// atomic, so any number of API instances can run workers against it.
+func NewMongoJobStore(collection *mongo.Collection) utils.JobStore {
+	return &mongoJobStore{collection: collection}
+}
+
+func (s *mongoJobStore) CreateJob(ctx context.Context, job models.Job) error {
+	_, err := s.collection.InsertOne(ctx, job)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *mongoJobStore) GetJob(ctx context.Context, jobID string) (models.Job, error) {
+	var job models.Job
+	err := s.collection.FindOne(ctx, bson.M{"_id": jobID}).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return job, ErrNotFound
+	}
+	return job, err
+}
+
+func (s *mongoJobStore) ListJobs(ctx context.Context, filter utils.JobFilter) ([]models.Job, error) {
+	query := bson.M{}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []models.Job{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *mongoJobStore) ClaimJob(ctx context.Context, worker string, now time.Time, lease time.Duration) (models.Job, bool, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": models.JobQueued, "run_at": bson.M{"$lte": now}},
+		bson.M{"status": models.JobRunning, "locked_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{
+			"status":       models.JobRunning,
+			"locked_by":    worker,
+			"locked_until": now.Add(lease),
+			"updated_at":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job models.Job
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return job, false, nil
+	}
+	if err != nil {
+		return job, false, err
+	}
+	return job, true, nil
+}
+
+// finish releases a job worker still holds after applying set.
+func (s *mongoJobStore) finish(ctx context.Context, jobID, worker string, set bson.M) error {
+	return s.update(ctx, jobID, worker, bson.M{"$set": set, "$unset": bson.M{"locked_by": "", "locked_until": ""}})
+}
+
+func (s *mongoJobStore) ExtendJobLease(ctx context.Context, jobID, worker string, until time.Time) error {
+	return s.update(ctx, jobID, worker, bson.M{"$set": bson.M{"locked_until": until}})
+}
+
+func (s *mongoJobStore) SetJobProgress(ctx context.Context, jobID, worker string, progress models.JobProgress) error {
+	return s.update(ctx, jobID, worker, bson.M{"$set": bson.M{"progress": progress, "updated_at": time.Now()}})
+}
+
+// update changes a job worker still holds.
+func (s *mongoJobStore) update(ctx context.Context, jobID, worker string, update bson.M) error {
+	res, err := s.collection.UpdateOne(ctx, bson.M{"_id": jobID, "status": models.JobRunning, "locked_by": worker}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoJobStore) CompleteJob(ctx context.Context, jobID, worker string, result map[string]string, now time.Time) error {
+	return s.finish(ctx, jobID, worker, bson.M{
+		"status":      models.JobSucceeded,
+		"result":      result,
+		"updated_at":  now,
+		"finished_at": now,
+	})
+}
+
+func (s *mongoJobStore) RetryJob(ctx context.Context, jobID, worker, lastErr string, runAt, now time.Time) error {
+	return s.finish(ctx, jobID, worker, bson.M{
+		"status":     models.JobQueued,
+		"last_error": lastErr,
+		"run_at":     runAt,
+		"updated_at": now,
+	})
+}
+
+func (s *mongoJobStore) BuryJob(ctx context.Context, jobID, worker, lastErr string, now time.Time) error {
+	return s.finish(ctx, jobID, worker, bson.M{
+		"status":      models.JobDead,
+		"last_error":  lastErr,
+		"updated_at":  now,
+		"finished_at": now,
+	})
+}
+
+func (s *mongoJobStore) RequeueJob(ctx context.Context, jobID string, now time.Time) error {
+	res, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": jobID, "status": models.JobDead},
+		bson.M{
+			"$set":   bson.M{"status": models.JobQueued, "attempts": 0, "run_at": now, "updated_at": now},
+			"$unset": bson.M{"finished_at": "", "callback_status": ""},
+		})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoJobStore) SetJobCallbackStatus(ctx context.Context, jobID, status string) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": jobID}, bson.M{"$set": bson.M{"callback_status": status}})
+	return err
+}
+
+// EraseUser forgets who created the user's jobs.
+func (s *mongoJobStore) EraseUser(ctx context.Context, userID string) error {
+	_, err := s.collection.UpdateMany(ctx, bson.M{"created_by": userID}, bson.M{"$unset": bson.M{"created_by": ""}})
+	return err
+}
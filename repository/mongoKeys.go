@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoKeyStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoKeyStore returns a utils.KeyStore backed by collection. The
+// keyring encrypts private keys before they get here, unless it was
+// configured to store them in plain text.
+func NewMongoKeyStore(collection *mongo.Collection) utils.KeyStore {
+	return &mongoKeyStore{collection: collection}
+}
+
+func (s *mongoKeyStore) LoadKeys(ctx context.Context) ([]models.SigningKey, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var keys []models.SigningKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *mongoKeyStore) SaveKey(ctx context.Context, key models.SigningKey) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": key.KeyID}, key, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoKeyStore) DeleteKey(ctx context.Context, keyID string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": keyID})
+	return err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoLoginAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoLoginAttemptRepository returns a LoginAttemptRepository backed by
+// collection. A TTL index on expires_at removes stale counters.
+func NewMongoLoginAttemptRepository(collection *mongo.Collection) LoginAttemptRepository {
+	return &mongoLoginAttemptRepository{collection: collection}
+}
+
+func (r *mongoLoginAttemptRepository) Get(ctx context.Context, keys []string) ([]LoginAttempt, error) {
+	// The TTL monitor only runs once a minute, so filter on expiry as well
+	filter := bson.M{"_id": bson.M{"$in": keys}, "expires_at": bson.M{"$gt": time.Now()}}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var attempts []LoginAttempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+func (r *mongoLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at, expiresAt time.Time) (LoginAttempt, error) {
+	// A counter past its expiry that the TTL monitor has not removed yet
+	// starts again from one.
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$expires_at", at}},
+				bson.M{"$add": bson.A{"$failures", 1}},
+				1,
+			}},
+			"last_failure_at": at,
+			"expires_at":      expiresAt,
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+
+	var previous LoginAttempt
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&previous)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && !previous.ExpiresAt.After(at)) {
+		return LoginAttempt{Key: key}, nil
+	}
+	return previous, err
+}
+
+func (r *mongoLoginAttemptRepository) Forgive(ctx context.Context, key string) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": key, "failures": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"failures": -1}})
+	return err
+}
+
+func (r *mongoLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func (r *mongoLoginAttemptRepository) EraseEmail(ctx context.Context, email string) error {
+	return r.Reset(ctx, AccountAttemptKey(email))
+}
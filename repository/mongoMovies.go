@@ -0,0 +1,433 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoSortFields maps the sort keys to their document fields. Sorting by
+// _id orders by insertion date, since ObjectIDs start with a timestamp.
+var mongoSortFields = map[string]string{
+	SortTitle:   "title",
+	SortRanking: "ranking.ranking_value",
+	SortCreated: "_id",
+}
+
+type mongoMovieRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoMovieRepository returns a MovieRepository backed by collection.
+func NewMongoMovieRepository(collection *mongo.Collection) MovieRepository {
+	return &mongoMovieRepository{collection: collection}
+}
+
+// activeMovie matches the movie with the given IMDb ID unless it is soft-deleted.
+func activeMovie(imdbID string) bson.M {
+	return bson.M{"imdb_id": imdbID, "deleted_at": bson.M{"$exists": false}}
+}
+
+// movieFilter builds the MongoDB filter for f. Soft-deleted movies are always
+// excluded.
+func movieFilter(f MovieFilter) bson.M {
+	filter := bson.M{"deleted_at": bson.M{"$exists": false}}
+
+	if len(f.GenreNames) > 0 {
+		filter["genres.genre_name"] = bson.M{"$in": f.GenreNames}
+	}
+	if len(f.GenreIDs) > 0 {
+		filter["genres.genre_id"] = bson.M{"$in": f.GenreIDs}
+	}
+
+	if f.RankingMin != nil || f.RankingMax != nil {
+		rng := bson.M{}
+		if f.RankingMin != nil {
+			rng["$gte"] = *f.RankingMin
+		}
+		if f.RankingMax != nil {
+			rng["$lte"] = *f.RankingMax
+		}
+		filter["ranking.ranking_value"] = rng
+	}
+
+	if f.TitlePrefix != "" {
+		filter["title"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(f.TitlePrefix), Options: "i"}
+	}
+
+	return filter
+}
+
+// movieSort returns the sort document, always tie-breaking on _id so that
+// cursors are stable. reverse flips the direction for backwards cursors.
+func movieSort(q MovieQuery, reverse bool) bson.D {
+	dir := 1
+	if q.Desc != reverse {
+		dir = -1
+	}
+	field := mongoSortFields[q.Sort]
+	if field == "_id" {
+		return bson.D{{Key: "_id", Value: dir}}
+	}
+	return bson.D{{Key: field, Value: dir}, {Key: "_id", Value: dir}}
+}
+
+// cursorFilter restricts the listing to documents after (or before) the cursor.
+func cursorFilter(q MovieQuery) bson.M {
+	cur := q.Cursor
+	op := "$gt"
+	if q.Desc != cur.Before {
+		op = "$lt"
+	}
+
+	field := mongoSortFields[q.Sort]
+	if field == "_id" {
+		return bson.M{"_id": bson.M{op: cur.ID}}
+	}
+
+	var value interface{} = cur.Title
+	if q.Sort == SortRanking {
+		value = cur.Ranking
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: value}},
+		bson.M{field: value, "_id": bson.M{op: cur.ID}},
+	}}
+}
+
+func (r *mongoMovieRepository) List(ctx context.Context, q MovieQuery) (MoviePage, error) {
+	if _, ok := mongoSortFields[q.Sort]; !ok {
+		q.Sort = SortCreated
+	}
+	filter := movieFilter(q.Filter)
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return MoviePage{}, err
+	}
+
+	// Fetch one extra document to know whether another page follows.
+	backwards := q.Cursor != nil && q.Cursor.Before
+	opts := options.Find().SetSort(movieSort(q, backwards)).SetLimit(int64(q.Limit + 1))
+	query := filter
+	if q.Cursor != nil {
+		query = bson.M{"$and": bson.A{filter, cursorFilter(q)}}
+	} else if q.Skip > 0 {
+		opts.SetSkip(int64(q.Skip))
+	}
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return MoviePage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var movies []models.Movie
+	if err := cursor.All(ctx, &movies); err != nil {
+		return MoviePage{}, err
+	}
+
+	page := MoviePage{Total: total, HasMore: len(movies) > q.Limit}
+	if page.HasMore {
+		movies = movies[:q.Limit]
+	}
+	if backwards {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+	page.Movies = movies
+	return page, nil
+}
+
+func (r *mongoMovieRepository) Each(ctx context.Context, filter MovieFilter, fn func(models.Movie) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, movieFilter(filter), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var movie models.Movie
+		if err := cursor.Decode(&movie); err != nil {
+			return err
+		}
+		if err := fn(movie); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *mongoMovieRepository) TextSearch(ctx context.Context, filter MovieFilter, text string, limit int) ([]ScoredMovie, error) {
+	query := bson.M{"$and": bson.A{movieFilter(filter), bson.M{"$text": bson.M{"$search": text}}}}
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		models.Movie `bson:",inline"`
+		Score        float64 `bson:"score"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	hits := make([]ScoredMovie, len(docs))
+	for i, d := range docs {
+		hits[i] = ScoredMovie{Movie: d.Movie, Score: d.Score}
+	}
+	return hits, nil
+}
+
+func (r *mongoMovieRepository) Get(ctx context.Context, imdbID string) (models.Movie, error) {
+	var movie models.Movie
+	err := r.collection.FindOne(ctx, activeMovie(imdbID)).Decode(&movie)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return movie, ErrNotFound
+	}
+	return movie, err
+}
+
+func (r *mongoMovieRepository) Create(ctx context.Context, movie models.Movie) (models.Movie, error) {
+	movie.ID = primitive.NilObjectID
+	movie.DeletedAt = nil
+	result, err := r.collection.InsertOne(ctx, movie)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return movie, ErrDuplicate
+		}
+		return movie, err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		movie.ID = id
+	}
+	return movie, nil
+}
+
+func (r *mongoMovieRepository) Update(ctx context.Context, imdbID string, patch MoviePatch) (models.Movie, error) {
+	set := bson.M{}
+	if patch.Title != nil {
+		set["title"] = *patch.Title
+	}
+	if patch.PosterPath != nil {
+		set["poster_path"] = *patch.PosterPath
+	}
+	if patch.YouTubeID != nil {
+		set["youtube_id"] = *patch.YouTubeID
+	}
+	if patch.Genres != nil {
+		set["genres"] = *patch.Genres
+	}
+	if len(set) == 0 {
+		return r.Get(ctx, imdbID)
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var movie models.Movie
+	err := r.collection.FindOneAndUpdate(ctx, activeMovie(imdbID), bson.M{"$set": set}, opts).Decode(&movie)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return movie, ErrNotFound
+	}
+	return movie, err
+}
+
+func (r *mongoMovieRepository) SetReview(ctx context.Context, imdbID, review string, ranking models.Ranking) error {
+	update := bson.M{
+		"$set": bson.M{
+			"admin_review": review,
+			"ranking": bson.M{
+				"ranking_name":  ranking.RankingName,
+				"ranking_value": ranking.RankingValue,
+			},
+		},
+		"$unset": bson.M{"ranking_status": "", "ranking_job_id": ""},
+	}
+	return r.updateOne(ctx, activeMovie(imdbID), update)
+}
+
+func (r *mongoMovieRepository) SetReviewPending(ctx context.Context, imdbID, review, jobID string) error {
+	update := bson.M{"$set": bson.M{
+		"admin_review":   review,
+		"ranking_status": models.RankingPending,
+		"ranking_job_id": jobID,
+	}}
+	return r.updateOne(ctx, activeMovie(imdbID), update)
+}
+
+func (r *mongoMovieRepository) FinishRanking(ctx context.Context, imdbID, jobID string, ranking models.Ranking) error {
+	filter := activeMovie(imdbID)
+	filter["ranking_job_id"] = jobID
+	update := bson.M{"$set": bson.M{
+		"ranking": bson.M{
+			"ranking_name":  ranking.RankingName,
+			"ranking_value": ranking.RankingValue,
+		},
+		"ranking_status": models.RankingRanked,
+	}}
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r *mongoMovieRepository) FailRanking(ctx context.Context, imdbID, jobID string) error {
+	filter := activeMovie(imdbID)
+	filter["ranking_job_id"] = jobID
+	return r.updateOne(ctx, filter, bson.M{"$set": bson.M{"ranking_status": models.RankingFailed}})
+}
+
+func (r *mongoMovieRepository) Rerank(ctx context.Context, imdbID, review string, ranking models.Ranking) error {
+	filter := activeMovie(imdbID)
+	filter["admin_review"] = review
+	filter["ranking_status"] = bson.M{"$ne": models.RankingPending}
+	update := bson.M{
+		"$set": bson.M{"ranking": bson.M{
+			"ranking_name":  ranking.RankingName,
+			"ranking_value": ranking.RankingValue,
+		}},
+		"$unset": bson.M{"ranking_status": "", "ranking_job_id": ""},
+	}
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r *mongoMovieRepository) SoftDelete(ctx context.Context, imdbID string, at time.Time) error {
+	return r.updateOne(ctx, activeMovie(imdbID), bson.M{"$set": bson.M{"deleted_at": at}})
+}
+
+func (r *mongoMovieRepository) Restore(ctx context.Context, imdbID string) error {
+	filter := bson.M{"imdb_id": imdbID, "deleted_at": bson.M{"$exists": true}}
+	return r.updateOne(ctx, filter, bson.M{"$unset": bson.M{"deleted_at": ""}})
+}
+
+func (r *mongoMovieRepository) updateOne(ctx context.Context, filter, update bson.M) error {
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoMovieRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	res, err := r.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lte": deletedBefore}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (r *mongoMovieRepository) ExistingImdbIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"imdb_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"imdb_id": 1, "deleted_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	existing := map[string]bool{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ImdbID    string     `bson:"imdb_id"`
+			DeletedAt *time.Time `bson:"deleted_at"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		existing[doc.ImdbID] = doc.DeletedAt != nil
+	}
+	return existing, cursor.Err()
+}
+
+// BulkUpsert sends all movies in a single unordered bulk write, so one bad
+// document does not stop the others. Only active movies match the filter, so
+// the upsert of a deleted one collides with the unique imdb_id index; so do
+// two imports inserting the same new movie at once, see upsertConflict.
+func (r *mongoMovieRepository) BulkUpsert(ctx context.Context, movies []models.Movie) ([]UpsertResult, error) {
+	results := make([]UpsertResult, len(movies))
+	if len(movies) == 0 {
+		return results, nil
+	}
+
+	updates := make([]bson.M, len(movies))
+	writes := make([]mongo.WriteModel, len(movies))
+	for i, m := range movies {
+		updates[i] = bson.M{"$set": bson.M{
+			"imdb_id":      m.ImdbID,
+			"title":        m.Title,
+			"poster_path":  m.PosterPath,
+			"youtube_id":   m.YouTubeID,
+			"genres":       m.Genres,
+			"admin_review": m.AdminReview,
+			"ranking":      m.Ranking,
+		}, "$unset": bson.M{"ranking_status": "", "ranking_job_id": ""}}
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(activeMovie(m.ImdbID)).
+			SetUpdate(updates[i]).
+			SetUpsert(true)
+	}
+
+	result, err := r.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+			return nil, err
+		}
+		for _, we := range bulkErr.WriteErrors {
+			if mongo.IsDuplicateKeyError(we) {
+				results[we.Index].Err = r.upsertConflict(ctx, movies[we.Index].ImdbID, updates[we.Index])
+				continue
+			}
+			results[we.Index].Err = errors.New(we.Message)
+		}
+	}
+
+	if result != nil {
+		for idx := range result.UpsertedIDs {
+			results[idx].Inserted = true
+		}
+	}
+	return results, nil
+}
+
+// upsertConflict works out why the upsert of imdbID hit the unique index:
+// either the movie is deleted, or another write inserted it first, in which
+// case the update is applied to that copy instead.
+func (r *mongoMovieRepository) upsertConflict(ctx context.Context, imdbID string, update bson.M) error {
+	var doc struct {
+		DeletedAt *time.Time `bson:"deleted_at"`
+	}
+	err := r.collection.FindOne(ctx, bson.M{"imdb_id": imdbID}).Decode(&doc)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrDuplicate
+	case err != nil:
+		return err
+	case doc.DeletedAt != nil:
+		return ErrMovieDeleted
+	}
+
+	result, err := r.collection.UpdateOne(ctx, activeMovie(imdbID), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoRerankRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRerankRepository returns a RerankRepository backed by collection.
+// A TTL index removes results 30 days after they were recorded.
+func NewMongoRerankRepository(collection *mongo.Collection) RerankRepository {
+	return &mongoRerankRepository{collection: collection}
+}
+
+func (r *mongoRerankRepository) Record(ctx context.Context, change models.RerankChange) error {
+	change.ID = change.RunID + "/" + change.ImdbID
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": change.ID}, change, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *mongoRerankRepository) List(ctx context.Context, runID string, filter RerankFilter) ([]models.RerankChange, error) {
+	query := bson.M{"run_id": runID}
+	if filter.Outcome != "" {
+		query["outcome"] = filter.Outcome
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "imdb_id", Value: 1}})
+	if filter.Skip > 0 {
+		opts.SetSkip(int64(filter.Skip))
+	}
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	changes := []models.RerankChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
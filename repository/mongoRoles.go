@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/samrato/magicstream/models"
+	"github.com/samrato/magicstream/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoRoleStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRoleStore returns a utils.RoleStore backed by collection, keyed by
+// role name.
+func NewMongoRoleStore(collection *mongo.Collection) utils.RoleStore {
+	return &mongoRoleStore{collection: collection}
+}
+
+func (s *mongoRoleStore) LoadRoles(ctx context.Context) ([]models.Role, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var roles []models.Role
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (s *mongoRoleStore) SaveRole(ctx context.Context, role models.Role) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": role.Name}, role, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoRoleStore) DeleteRole(ctx context.Context, name string) error {
+	res, err := s.collection.DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
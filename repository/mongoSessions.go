@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoSessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSessionRepository returns a SessionRepository backed by collection.
+// A TTL index on expires_at removes expired sessions.
+func NewMongoSessionRepository(collection *mongo.Collection) SessionRepository {
+	return &mongoSessionRepository{collection: collection}
+}
+
+func activeSession(now time.Time) bson.M {
+	return bson.M{"revoked_at": bson.M{"$exists": false}, "expires_at": bson.M{"$gt": now}}
+}
+
+func (r *mongoSessionRepository) Create(ctx context.Context, session models.Session) error {
+	session.ID = primitive.NilObjectID
+	_, err := r.collection.InsertOne(ctx, session)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoSessionRepository) Get(ctx context.Context, sessionID string) (models.Session, error) {
+	var session models.Session
+	err := r.collection.FindOne(ctx, bson.M{"session_id": sessionID}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return session, ErrNotFound
+	}
+	return session, err
+}
+
+func (r *mongoSessionRepository) ListActive(ctx context.Context, userID string) ([]models.Session, error) {
+	filter := activeSession(time.Now())
+	filter["user_id"] = userID
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *mongoSessionRepository) Rotate(ctx context.Context, sessionID, oldRefreshID, newRefreshID string, usedAt, expiresAt time.Time) error {
+	filter := activeSession(usedAt)
+	filter["session_id"] = sessionID
+	filter["refresh_id"] = oldRefreshID
+	update := bson.M{"$set": bson.M{
+		"refresh_id":   newRefreshID,
+		"last_used_at": usedAt,
+		"expires_at":   expiresAt,
+	}}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoSessionRepository) Revoke(ctx context.Context, sessionID, reason string, at time.Time) error {
+	filter := bson.M{"session_id": sessionID, "revoked_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revoked_at": at, "revoked_reason": reason}}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoSessionRepository) RevokeAll(ctx context.Context, userID, reason string, at time.Time) (int64, error) {
+	filter := activeSession(at)
+	filter["user_id"] = userID
+	update := bson.M{"$set": bson.M{"revoked_at": at, "revoked_reason": reason}}
+	res, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func (r *mongoSessionRepository) EraseUser(ctx context.Context, userID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
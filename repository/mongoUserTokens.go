@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoUserTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserTokenRepository returns a UserTokenRepository backed by
+// collection. A TTL index on expires_at removes expired tokens.
+func NewMongoUserTokenRepository(collection *mongo.Collection) UserTokenRepository {
+	return &mongoUserTokenRepository{collection: collection}
+}
+
+func (r *mongoUserTokenRepository) Create(ctx context.Context, token models.UserToken) error {
+	token.ID = primitive.NilObjectID
+	_, err := r.collection.InsertOne(ctx, token)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoUserTokenRepository) Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error) {
+	filter := bson.M{"token_hash": tokenHash, "purpose": purpose, "expires_at": bson.M{"$gt": now}}
+	var token models.UserToken
+	err := r.collection.FindOneAndDelete(ctx, filter).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return token, ErrNotFound
+	}
+	return token, err
+}
+
+func (r *mongoUserTokenRepository) Latest(ctx context.Context, userID, purpose string) (models.UserToken, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	var token models.UserToken
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "purpose": purpose}, opts).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return token, ErrNotFound
+	}
+	return token, err
+}
+
+func (r *mongoUserTokenRepository) DeleteForUser(ctx context.Context, userID, purpose string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
+	return err
+}
+
+func (r *mongoUserTokenRepository) EraseUser(ctx context.Context, userID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
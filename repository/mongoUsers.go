@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserRepository returns a UserRepository backed by collection.
+func NewMongoUserRepository(collection *mongo.Collection) UserRepository {
+	return &mongoUserRepository{collection: collection}
+}
+
+func (r *mongoUserRepository) Create(ctx context.Context, user models.User) (models.User, error) {
+	user.ID = primitive.NilObjectID
+	result, err := r.collection.InsertOne(ctx, user)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return user, ErrDuplicate
+		}
+		return user, err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		user.ID = id
+	}
+	return user, nil
+}
+
+func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) GetByUserID(ctx context.Context, userID string) (models.User, error) {
+	return r.findOne(ctx, bson.M{"user_id": userID})
+}
+
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *mongoUserRepository) UpdateFavouriteGenres(ctx context.Context, userID string, genres []models.Genre) error {
+	update := bson.M{"$set": bson.M{"favourite_genres": genres, "updated_at": time.Now()}}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
+	update := bson.M{"$set": bson.M{"password": passwordHash, "updated_at": time.Now()}}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) MarkEmailVerified(ctx context.Context, userID string, at time.Time) error {
+	update := bson.M{"$set": bson.M{"email_verified": true, "email_verified_at": at, "updated_at": at}}
+	res, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) UpdateProfile(ctx context.Context, userID string, patch UserPatch) (models.User, error) {
+	set := bson.M{"updated_at": time.Now()}
+	if patch.FirstName != nil {
+		set["first_name"] = *patch.FirstName
+	}
+	if patch.LastName != nil {
+		set["last_name"] = *patch.LastName
+	}
+
+	filter := bson.M{"user_id": userID, "deleted_at": bson.M{"$exists": false}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var user models.User
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *mongoUserRepository) SoftDelete(ctx context.Context, userID string, at time.Time) error {
+	filter := bson.M{"user_id": userID, "deleted_at": bson.M{"$exists": false}}
+	res, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"deleted_at": at, "updated_at": at}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) DeletedBefore(ctx context.Context, cutoff time.Time) ([]models.User, error) {
+	filter := bson.M{"deleted_at": bson.M{"$lte": cutoff}, "anonymised_at": bson.M{"$exists": false}}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *mongoUserRepository) Anonymise(ctx context.Context, userID string, at time.Time) error {
+	filter := bson.M{"user_id": userID, "deleted_at": bson.M{"$exists": true}}
+	update := bson.M{
+		"$set": bson.M{
+			"first_name":       "Deleted",
+			"last_name":        "User",
+			"email":            AnonymousEmail(userID),
+			"password":         "",
+			"favourite_genres": []models.Genre{},
+			"anonymised_at":    at,
+			"updated_at":       at,
+		},
+		"$unset": bson.M{"token": "", "refresh_token": "", "email_verified_at": "", "mfa": ""},
+	}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func userFilter(f UserFilter) bson.M {
+	filter := bson.M{}
+	if f.Search != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(f.Search), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"first_name": pattern},
+			bson.M{"last_name": pattern},
+			bson.M{"email": pattern},
+		}
+	}
+	if f.Role != "" {
+		filter["role"] = f.Role
+	}
+	switch f.Status {
+	case UserStatusActive:
+		filter["disabled"] = bson.M{"$ne": true}
+		filter["deleted_at"] = bson.M{"$exists": false}
+	case UserStatusDisabled:
+		filter["disabled"] = true
+		filter["deleted_at"] = bson.M{"$exists": false}
+	case UserStatusDeleted:
+		filter["deleted_at"] = bson.M{"$exists": true}
+	}
+	return filter
+}
+
+func (r *mongoUserRepository) List(ctx context.Context, q UserQuery) (UserPage, error) {
+	filter := userFilter(q.Filter)
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(q.Skip)).
+		SetLimit(int64(q.Limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return UserPage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return UserPage{}, err
+	}
+	return UserPage{Users: users, Total: total}, nil
+}
+
+func (r *mongoUserRepository) SetRole(ctx context.Context, userID, role string) error {
+	update := bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}}
+	return r.updateOne(ctx, bson.M{"user_id": userID}, update)
+}
+
+func (r *mongoUserRepository) SetDisabled(ctx context.Context, userID string, disabled bool, at time.Time) error {
+	update := bson.M{
+		"$set": bson.M{"disabled": true, "disabled_at": at, "updated_at": at},
+	}
+	if !disabled {
+		update = bson.M{
+			"$set":   bson.M{"updated_at": at},
+			"$unset": bson.M{"disabled": "", "disabled_at": ""},
+		}
+	}
+	return r.updateOne(ctx, bson.M{"user_id": userID}, update)
+}
+
+func (r *mongoUserRepository) updateOne(ctx context.Context, filter, update bson.M) error {
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) SetMFA(ctx context.Context, userID string, mfa *models.UserMFA) error {
+	update := bson.M{"$set": bson.M{"mfa": mfa, "updated_at": time.Now()}}
+	if mfa == nil {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"mfa": ""}}
+	}
+	return r.updateOne(ctx, bson.M{"user_id": userID}, update)
+}
+
+func (r *mongoUserRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	filter := bson.M{
+		"user_id":    userID,
+		"mfa.secret": bson.M{"$exists": true},
+		"$or": bson.A{
+			bson.M{"mfa.last_used_step": bson.M{"$exists": false}},
+			bson.M{"mfa.last_used_step": bson.M{"$lt": step}},
+		},
+	}
+	return r.updateOne(ctx, filter, bson.M{"$set": bson.M{"mfa.last_used_step": step}})
+}
+
+func (r *mongoUserRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	filter := bson.M{"user_id": userID, "mfa.recovery_codes": codeHash}
+	return r.updateOne(ctx, filter, bson.M{"$pull": bson.M{"mfa.recovery_codes": codeHash}})
+}
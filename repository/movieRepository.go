@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sort keys accepted by MovieQuery. SortCreated orders by insertion date.
+const (
+	SortTitle   = "title"
+	SortRanking = "ranking"
+	SortCreated = "created"
+)
+
+// MovieFilter restricts which movies a listing, search or scan returns.
+// Soft-deleted movies are always excluded.
+type MovieFilter struct {
+	GenreNames  []string
+	GenreIDs    []int
+	RankingMin  *int
+	RankingMax  *int
+	TitlePrefix string
+}
+
+// MovieCursor marks a position in a sorted listing: the sort value and ID of
+// the last (or, with Before set, the first) movie of the previous page.
+type MovieCursor struct {
+	Before  bool
+	Title   string
+	Ranking int
+	ID      primitive.ObjectID
+}
+
+// MovieQuery describes one page of a movie listing. When Cursor is set, Skip
+// is ignored and the page starts right after (or before) the cursor.
+type MovieQuery struct {
+	Filter MovieFilter
+	Sort   string
+	Desc   bool
+	Skip   int
+	Limit  int
+	Cursor *MovieCursor
+}
+
+// MoviePage is one page of a listing, in the requested order. Total counts
+// every movie matching the filter and HasMore reports whether more movies
+// follow in the direction of travel.
+type MoviePage struct {
+	Movies  []models.Movie
+	Total   int64
+	HasMore bool
+}
+
+// MoviePatch holds the fields of a partial update; nil fields are untouched.
+type MoviePatch struct {
+	Title      *string
+	PosterPath *string
+	YouTubeID  *string
+	Genres     *[]models.Genre
+}
+
+// ScoredMovie is a full-text search hit.
+type ScoredMovie struct {
+	Movie models.Movie
+	Score float64
+}
+
+// UpsertResult is the outcome of one movie in a BulkUpsert.
+type UpsertResult struct {
+	Inserted bool
+	Err      error
+}
+
+// MovieRepository stores the movie catalog. Unless stated otherwise, methods
+// ignore soft-deleted movies and return ErrNotFound when nothing matches.
+type MovieRepository interface {
+	List(ctx context.Context, q MovieQuery) (MoviePage, error)
+	// Each calls fn for every movie matching filter in insertion order,
+	// streaming from storage. It stops at and returns the first error of fn.
+	Each(ctx context.Context, filter MovieFilter, fn func(models.Movie) error) error
+	TextSearch(ctx context.Context, filter MovieFilter, text string, limit int) ([]ScoredMovie, error)
+	Get(ctx context.Context, imdbID string) (models.Movie, error)
+	Create(ctx context.Context, movie models.Movie) (models.Movie, error)
+	Update(ctx context.Context, imdbID string, patch MoviePatch) (models.Movie, error)
+	SetReview(ctx context.Context, imdbID, review string, ranking models.Ranking) error
+	// SetReviewPending saves the review and marks its ranking pending until
+	// the job jobID classifies it.
+	SetReviewPending(ctx context.Context, imdbID, review, jobID string) error
+	// FinishRanking stores the ranking chosen by jobID, and FailRanking marks
+	// the ranking failed. Both return ErrNotFound when the movie is gone or a
+	// newer review replaced the one the job was classifying.
+	FinishRanking(ctx context.Context, imdbID, jobID string, ranking models.Ranking) error
+	FailRanking(ctx context.Context, imdbID, jobID string) error
+	// Rerank replaces the ranking of a movie whose review is still review
+	// and is not waiting for a ranking job. It returns ErrNotFound otherwise.
+	Rerank(ctx context.Context, imdbID, review string, ranking models.Ranking) error
+	SoftDelete(ctx context.Context, imdbID string, at time.Time) error
+	// Restore undeletes a soft-deleted movie.
+	Restore(ctx context.Context, imdbID string) error
+	// Purge removes movies soft-deleted at or before the given time.
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// ExistingImdbIDs reports which of ids exist, mapped to whether the movie
+	// is soft-deleted.
+	ExistingImdbIDs(ctx context.Context, ids []string) (map[string]bool, error)
+	// BulkUpsert inserts or replaces the catalog fields of each movie keyed on
+	// imdb_id. A movie that is soft-deleted is left alone and its result is
+	// ErrMovieDeleted. Results are in the same order as movies.
+	BulkUpsert(ctx context.Context, movies []models.Movie) ([]UpsertResult, error)
+}
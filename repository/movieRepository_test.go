@@ -0,0 +1,434 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/samrato/magicstream/database"
+	"github.com/samrato/magicstream/models"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// movieRepositories returns a constructor for every MovieRepository
+// implementation under test. The MongoDB one only runs when
+// MONGODB_TEST_URI is set; each repository gets a fresh, migrated database
+// that is dropped afterwards.
+func movieRepositories(t *testing.T) map[string]func(t *testing.T) MovieRepository {
+	impls := map[string]func(t *testing.T) MovieRepository{
+		"memory": func(t *testing.T) MovieRepository { return NewMemoryMovieRepository() },
+	}
+
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Log("MONGODB_TEST_URI not set, skipping the MongoDB movie repository")
+		return impls
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to MongoDB: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	impls["mongo"] = func(t *testing.T) MovieRepository {
+		suffix := make([]byte, 6)
+		if _, err := rand.Read(suffix); err != nil {
+			t.Fatal(err)
+		}
+		db := client.Database("magicstream_test_" + hex.EncodeToString(suffix))
+		t.Cleanup(func() { db.Drop(context.Background()) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if _, err := database.NewMigrator(db, database.Migrations).Up(ctx, 0); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		return NewMongoMovieRepository(db.Collection("movies"))
+	}
+	return impls
+}
+
+// TestMovieRepositoryParity runs the same cases against every
+// implementation, so the in-memory one keeps behaving like MongoDB.
+func TestMovieRepositoryParity(t *testing.T) {
+	cases := map[string]func(t *testing.T, repo MovieRepository){
+		"create and get":      testMovieCreateGet,
+		"update":              testMovieUpdate,
+		"soft delete":         testMovieSoftDelete,
+		"list":                testMovieList,
+		"list cursor":         testMovieListCursor,
+		"each":                testMovieEach,
+		"text search":         testMovieTextSearch,
+		"review ranking":      testMovieReviewRanking,
+		"existing and upsert": testMovieBulkUpsert,
+	}
+	for implName, newRepo := range movieRepositories(t) {
+		for name, run := range cases {
+			t.Run(implName+"/"+name, func(t *testing.T) {
+				run(t, newRepo(t))
+			})
+		}
+	}
+}
+
+func parityMovie(imdbID, title string, ranking int, genres ...string) models.Movie {
+	m := models.Movie{
+		ImdbID:     imdbID,
+		Title:      title,
+		PosterPath: "https://example.com/" + imdbID + ".jpg",
+		YouTubeID:  "yt" + imdbID,
+		Ranking:    models.Ranking{RankingValue: ranking, RankingName: fmt.Sprint("Rank ", ranking)},
+	}
+	for i, name := range genres {
+		m.Genres = append(m.Genres, models.Genre{GenreID: i + 1, GenreName: name})
+	}
+	return m
+}
+
+func seedMovies(t *testing.T, repo MovieRepository, movies ...models.Movie) {
+	t.Helper()
+	for _, m := range movies {
+		if _, err := repo.Create(context.Background(), m); err != nil {
+			t.Fatalf("create %s: %v", m.ImdbID, err)
+		}
+	}
+}
+
+func movieTitles(movies []models.Movie) string {
+	titles := make([]string, len(movies))
+	for i, m := range movies {
+		titles[i] = m.Title
+	}
+	return fmt.Sprint(titles)
+}
+
+func intPtr(n int) *int { return &n }
+
+func testMovieCreateGet(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	created, err := repo.Create(ctx, parityMovie("tt1", "Heat", 3, "Crime"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID.IsZero() {
+		t.Fatal("Create did not set the ID")
+	}
+
+	got, err := repo.Get(ctx, "tt1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != created.ID || got.Title != "Heat" || len(got.Genres) != 1 || got.Genres[0].GenreName != "Crime" {
+		t.Fatalf("Get = %+v", got)
+	}
+
+	if _, err := repo.Create(ctx, parityMovie("tt1", "Heat again", 1)); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("duplicate Create = %v, want ErrDuplicate", err)
+	}
+	if _, err := repo.Get(ctx, "tt404"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing = %v, want ErrNotFound", err)
+	}
+}
+
+func testMovieUpdate(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	seedMovies(t, repo, parityMovie("tt1", "Heat", 3, "Crime"))
+
+	title := "Heat (1995)"
+	genres := []models.Genre{{GenreID: 7, GenreName: "Thriller"}}
+	updated, err := repo.Update(ctx, "tt1", MoviePatch{Title: &title, Genres: &genres})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != title || len(updated.Genres) != 1 || updated.Genres[0].GenreID != 7 || updated.YouTubeID != "yttt1" {
+		t.Fatalf("Update = %+v", updated)
+	}
+	if got, _ := repo.Get(ctx, "tt1"); got.Title != title {
+		t.Fatalf("Get after Update = %q", got.Title)
+	}
+	if _, err := repo.Update(ctx, "tt404", MoviePatch{Title: &title}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Update missing = %v, want ErrNotFound", err)
+	}
+}
+
+func testMovieSoftDelete(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	seedMovies(t, repo, parityMovie("tt1", "Heat", 3), parityMovie("tt2", "Alien", 1))
+	deletedAt := time.Now().Truncate(time.Millisecond)
+
+	if err := repo.SoftDelete(ctx, "tt1", deletedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, "tt1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get deleted = %v, want ErrNotFound", err)
+	}
+	if err := repo.SoftDelete(ctx, "tt1", deletedAt); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SoftDelete twice = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.Create(ctx, parityMovie("tt1", "Heat", 3)); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("Create over deleted = %v, want ErrDuplicate", err)
+	}
+	page, err := repo.List(ctx, MovieQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || movieTitles(page.Movies) != "[Alien]" {
+		t.Fatalf("List with deleted = %d %s", page.Total, movieTitles(page.Movies))
+	}
+
+	if err := repo.Restore(ctx, "tt1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Restore(ctx, "tt1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Restore active = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.Get(ctx, "tt1"); err != nil {
+		t.Fatalf("Get restored = %v", err)
+	}
+
+	if err := repo.SoftDelete(ctx, "tt1", deletedAt); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := repo.Purge(ctx, deletedAt.Add(-time.Second)); err != nil || n != 0 {
+		t.Fatalf("Purge before deletion = %d, %v", n, err)
+	}
+	if n, err := repo.Purge(ctx, deletedAt); err != nil || n != 1 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	if err := repo.Restore(ctx, "tt1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Restore purged = %v, want ErrNotFound", err)
+	}
+}
+
+func testMovieList(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	seedMovies(t, repo,
+		parityMovie("tt1", "Heat", 3, "Crime"),
+		parityMovie("tt2", "Alien", 1, "Horror"),
+		parityMovie("tt3", "Drive", 2, "Crime", "Drama"),
+		parityMovie("tt4", "Casablanca", 5, "Drama"),
+		parityMovie("tt5", "Aliens", 4, "Horror"),
+	)
+
+	tests := []struct {
+		name    string
+		q       MovieQuery
+		want    string
+		total   int64
+		hasMore bool
+	}{
+		{"insertion order", MovieQuery{Limit: 10}, "[Heat Alien Drive Casablanca Aliens]", 5, false},
+		{"by title", MovieQuery{Sort: SortTitle, Limit: 2}, "[Alien Aliens]", 5, true},
+		{"by title skip", MovieQuery{Sort: SortTitle, Skip: 4, Limit: 2}, "[Heat]", 5, false},
+		{"by ranking desc", MovieQuery{Sort: SortRanking, Desc: true, Limit: 3}, "[Casablanca Aliens Heat]", 5, true},
+		{"genre name", MovieQuery{Sort: SortTitle, Limit: 10, Filter: MovieFilter{GenreNames: []string{"Drama"}}}, "[Casablanca Drive]", 2, false},
+		{"genre id", MovieQuery{Sort: SortTitle, Limit: 10, Filter: MovieFilter{GenreIDs: []int{2}}}, "[Drive]", 1, false},
+		{"ranking range", MovieQuery{Sort: SortRanking, Limit: 10, Filter: MovieFilter{RankingMin: intPtr(2), RankingMax: intPtr(4)}}, "[Drive Heat Aliens]", 3, false},
+		{"title prefix", MovieQuery{Sort: SortTitle, Limit: 10, Filter: MovieFilter{TitlePrefix: "ali"}}, "[Alien Aliens]", 2, false},
+		{"no match", MovieQuery{Limit: 10, Filter: MovieFilter{GenreNames: []string{"Western"}}}, "[]", 0, false},
+	}
+	for _, tt := range tests {
+		page, err := repo.List(ctx, tt.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := movieTitles(page.Movies); got != tt.want || page.Total != tt.total || page.HasMore != tt.hasMore {
+			t.Errorf("%s: got %s total %d more %v, want %s total %d more %v",
+				tt.name, got, page.Total, page.HasMore, tt.want, tt.total, tt.hasMore)
+		}
+	}
+}
+
+func testMovieListCursor(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	seedMovies(t, repo,
+		parityMovie("tt1", "Heat", 3),
+		parityMovie("tt2", "Alien", 3),
+		parityMovie("tt3", "Drive", 2),
+		parityMovie("tt4", "Casablanca", 5),
+	)
+
+	first, err := repo.List(ctx, MovieQuery{Sort: SortRanking, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Equal rankings fall back to insertion order
+	if got := movieTitles(first.Movies); got != "[Drive Heat]" || !first.HasMore {
+		t.Fatalf("first page = %s more %v", got, first.HasMore)
+	}
+
+	last := first.Movies[1]
+	next, err := repo.List(ctx, MovieQuery{Sort: SortRanking, Limit: 2, Cursor: &MovieCursor{Ranking: last.Ranking.RankingValue, Title: last.Title, ID: last.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := movieTitles(next.Movies); got != "[Alien Casablanca]" || next.HasMore {
+		t.Fatalf("next page = %s more %v", got, next.HasMore)
+	}
+
+	head := next.Movies[0]
+	prev, err := repo.List(ctx, MovieQuery{Sort: SortRanking, Limit: 1, Cursor: &MovieCursor{Before: true, Ranking: head.Ranking.RankingValue, Title: head.Title, ID: head.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := movieTitles(prev.Movies); got != "[Heat]" || !prev.HasMore {
+		t.Fatalf("previous page = %s more %v", got, prev.HasMore)
+	}
+}
+
+func testMovieEach(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	seedMovies(t, repo,
+		parityMovie("tt1", "Heat", 3, "Crime"),
+		parityMovie("tt2", "Alien", 1, "Horror"),
+		parityMovie("tt3", "Drive", 2, "Crime"),
+	)
+
+	var seen []models.Movie
+	err := repo.Each(ctx, MovieFilter{GenreNames: []string{"Crime"}}, func(m models.Movie) error {
+		seen = append(seen, m)
+		return nil
+	})
+	if err != nil || movieTitles(seen) != "[Heat Drive]" {
+		t.Fatalf("Each = %s, %v", movieTitles(seen), err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.Each(ctx, MovieFilter{}, func(models.Movie) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("Each with error = %v after %d calls", err, calls)
+	}
+}
+
+func testMovieTextSearch(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	seedMovies(t, repo,
+		parityMovie("tt1", "The Matrix", 5, "Action"),
+		parityMovie("tt2", "Alien", 4, "Horror"),
+		parityMovie("tt3", "Inception", 4, "Action"),
+	)
+	if err := repo.SetReview(ctx, "tt3", "Layered like the matrix, but warmer", models.Ranking{RankingValue: 4, RankingName: "Good"}); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := repo.TextSearch(ctx, MovieFilter{}, "matrix", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].Movie.Title != "The Matrix" || hits[1].Movie.Title != "Inception" {
+		t.Fatalf("TextSearch = %v", hits)
+	}
+	if hits[0].Score <= hits[1].Score {
+		t.Fatalf("title hit scored %v, review hit %v", hits[0].Score, hits[1].Score)
+	}
+
+	hits, err = repo.TextSearch(ctx, MovieFilter{GenreNames: []string{"Horror"}}, "matrix", 10)
+	if err != nil || len(hits) != 0 {
+		t.Fatalf("filtered TextSearch = %v, %v", hits, err)
+	}
+	hits, err = repo.TextSearch(ctx, MovieFilter{}, "matrix", 1)
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("limited TextSearch = %v, %v", hits, err)
+	}
+}
+
+func testMovieReviewRanking(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	seedMovies(t, repo, parityMovie("tt1", "Heat", 3))
+	good := models.Ranking{RankingValue: 2, RankingName: "Good"}
+
+	if err := repo.SetReviewPending(ctx, "tt1", "Tense and precise", "job-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.Get(ctx, "tt1"); got.RankingStatus != models.RankingPending || got.RankingJobID != "job-1" || got.AdminReview != "Tense and precise" {
+		t.Fatalf("pending movie = %+v", got)
+	}
+	if err := repo.Rerank(ctx, "tt1", "Tense and precise", good); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Rerank while pending = %v, want ErrNotFound", err)
+	}
+	if err := repo.FinishRanking(ctx, "tt1", "job-0", good); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("FinishRanking by stale job = %v, want ErrNotFound", err)
+	}
+	if err := repo.FinishRanking(ctx, "tt1", "job-1", good); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.Get(ctx, "tt1"); got.RankingStatus != models.RankingRanked || got.Ranking != good {
+		t.Fatalf("ranked movie = %+v", got)
+	}
+
+	if err := repo.SetReviewPending(ctx, "tt1", "Overlong", "job-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.FailRanking(ctx, "tt1", "job-2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.Get(ctx, "tt1"); got.RankingStatus != models.RankingFailed {
+		t.Fatalf("failed ranking status = %q", got.RankingStatus)
+	}
+
+	bad := models.Ranking{RankingValue: 4, RankingName: "Bad"}
+	if err := repo.Rerank(ctx, "tt1", "Something else", bad); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Rerank of a changed review = %v, want ErrNotFound", err)
+	}
+	if err := repo.Rerank(ctx, "tt1", "Overlong", bad); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.Get(ctx, "tt1"); got.Ranking != bad || got.RankingStatus != "" || got.RankingJobID != "" {
+		t.Fatalf("reranked movie = %+v", got)
+	}
+}
+
+func testMovieBulkUpsert(t *testing.T, repo MovieRepository) {
+	ctx := context.Background()
+	seedMovies(t, repo, parityMovie("tt1", "Heat", 3), parityMovie("tt2", "Alien", 1))
+	if err := repo.SoftDelete(ctx, "tt2", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	existing, err := repo.ExistingImdbIDs(ctx, []string{"tt1", "tt2", "tt3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existing) != 2 || existing["tt1"] || !existing["tt2"] {
+		t.Fatalf("ExistingImdbIDs = %v", existing)
+	}
+
+	results, err := repo.BulkUpsert(ctx, []models.Movie{
+		parityMovie("tt1", "Heat (1995)", 4),
+		parityMovie("tt2", "Alien (1979)", 2),
+		parityMovie("tt3", "Drive", 2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 ||
+		results[0].Inserted || results[0].Err != nil ||
+		results[1].Inserted || !errors.Is(results[1].Err, ErrMovieDeleted) ||
+		!results[2].Inserted || results[2].Err != nil {
+		t.Fatalf("BulkUpsert = %+v", results)
+	}
+
+	if got, _ := repo.Get(ctx, "tt1"); got.Title != "Heat (1995)" || got.Ranking.RankingValue != 4 {
+		t.Fatalf("upserted movie = %+v", got)
+	}
+	if _, err := repo.Get(ctx, "tt2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted movie after BulkUpsert = %v, want ErrNotFound", err)
+	}
+	if got, _ := repo.Get(ctx, "tt3"); got.Title != "Drive" {
+		t.Fatalf("inserted movie = %+v", got)
+	}
+	if results, err := repo.BulkUpsert(ctx, nil); err != nil || len(results) != 0 {
+		t.Fatalf("empty BulkUpsert = %v, %v", results, err)
+	}
+}
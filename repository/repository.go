@@ -0,0 +1,114 @@
+// Package repository defines the storage interfaces used by the HTTP
+// handlers, with a MongoDB implementation and a thread-safe in-memory one
+// that lets the whole API run without a database.
+package repository
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/samrato/magicstream/database"
+	"github.com/samrato/magicstream/utils"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrNotFound is returned when the requested document does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a write would break a uniqueness rule.
+	ErrDuplicate = errors.New("duplicate key")
+	// ErrMovieDeleted is returned when an import targets a soft-deleted movie.
+	// Such movies must be restored before they can be imported over.
+	ErrMovieDeleted = errors.New("movie is deleted")
+)
+
+// Repositories bundles every repository the API depends on.
+type Repositories struct {
+	Movies        MovieRepository
+	Users         UserRepository
+	Genres        GenreRepository
+	Rankings      RankingRepository
+	Sessions      SessionRepository
+	Denylist      DenylistRepository
+	Keys          utils.KeyStore
+	Tokens        UserTokenRepository
+	Audit         AuditRepository
+	Roles         utils.RoleStore
+	LoginAttempts LoginAttemptRepository
+	Identities    IdentityRepository
+	OIDCFlows     OIDCFlowRepository
+	APIKeys       APIKeyRepository
+	Jobs          utils.JobStore
+	Reranks       RerankRepository
+}
+
+// NewMongoRepositories returns repositories backed by MongoDB.
+func NewMongoRepositories(client *mongo.Client) *Repositories {
+	return &Repositories{
+		Movies:        NewMongoMovieRepository(database.GetCollection(client, "movies")),
+		Users:         NewMongoUserRepository(database.GetCollection(client, "users")),
+		Genres:        NewMongoGenreRepository(database.GetCollection(client, "genres")),
+		Rankings:      NewMongoRankingRepository(database.GetCollection(client, "rankings")),
+		Sessions:      NewMongoSessionRepository(database.GetCollection(client, "sessions")),
+		Denylist:      NewMongoDenylistRepository(database.GetCollection(client, "token_denylist")),
+		Keys:          NewMongoKeyStore(database.GetCollection(client, "signing_keys")),
+		Tokens:        NewMongoUserTokenRepository(database.GetCollection(client, "user_tokens")),
+		Audit:         NewMongoAuditRepository(database.GetCollection(client, "audit_log")),
+		Roles:         NewMongoRoleStore(database.GetCollection(client, "roles")),
+		LoginAttempts: NewMongoLoginAttemptRepository(database.GetCollection(client, "login_attempts")),
+		Identities:    NewMongoIdentityRepository(database.GetCollection(client, "user_identities")),
+		OIDCFlows:     NewMongoOIDCFlowRepository(database.GetCollection(client, "oidc_flows")),
+		APIKeys:       NewMongoAPIKeyRepository(database.GetCollection(client, "api_keys")),
+		Jobs:          NewMongoJobStore(database.GetCollection(client, "jobs")),
+		Reranks:       NewMongoRerankRepository(database.GetCollection(client, "rerank_changes")),
+	}
+}
+
+// NewMemoryRepositories returns empty in-memory repositories, except for
+// genres and rankings which are seeded with the default catalog values.
+func NewMemoryRepositories() *Repositories {
+	return &Repositories{
+		Movies:        NewMemoryMovieRepository(),
+		Users:         NewMemoryUserRepository(),
+		Genres:        NewMemoryGenreRepository(DefaultGenres...),
+		Rankings:      NewMemoryRankingRepository(DefaultRankings...),
+		Sessions:      NewMemorySessionRepository(),
+		Denylist:      NewMemoryDenylistRepository(),
+		Keys:          NewMemoryKeyStore(),
+		Tokens:        NewMemoryUserTokenRepository(),
+		Audit:         NewMemoryAuditRepository(),
+		Roles:         NewMemoryRoleStore(),
+		LoginAttempts: NewMemoryLoginAttemptRepository(),
+		Identities:    NewMemoryIdentityRepository(),
+		OIDCFlows:     NewMemoryOIDCFlowRepository(),
+		APIKeys:       NewMemoryAPIKeyRepository(),
+		Jobs:          NewMemoryJobStore(),
+		Reranks:       NewMemoryRerankRepository(),
+	}
+}
+
+// UserDataErasers returns every repository that keeps per-user data. It
+// walks all fields, so a repository added later is included automatically
+// once it implements UserDataEraser.
+func (r *Repositories) UserDataErasers() []UserDataEraser {
+	return implementing[UserDataEraser](r)
+}
+
+// UserEmailErasers returns every repository that keeps per-user data keyed
+// on the email address.
+func (r *Repositories) UserEmailErasers() []UserEmailEraser {
+	return implementing[UserEmailEraser](r)
+}
+
+// implementing returns every field of r that implements T.
+func implementing[T any](r *Repositories) []T {
+	var found []T
+	v := reflect.ValueOf(r).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if e, ok := v.Field(i).Interface().(T); ok {
+			found = append(found, e)
+		}
+	}
+	return found
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// RerankFilter narrows the changes listed for a run. An empty Outcome
+// matches every outcome.
+type RerankFilter struct {
+	Outcome string
+	Skip    int
+	Limit   int
+}
+
+// RerankRepository stores the per-movie results of catalog re-ranking runs,
+// one per run and movie.
+type RerankRepository interface {
+	// Record stores change, replacing an earlier result for the same movie
+	// in the same run.
+	Record(ctx context.Context, change models.RerankChange) error
+	// List returns the run's results in imdb_id order.
+	List(ctx context.Context, runID string, filter RerankFilter) ([]models.RerankChange, error)
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// Reasons recorded when a session is revoked.
+const (
+	RevokedLogout        = "logout"
+	RevokedByUser        = "revoked_by_user"
+	RevokedTokenReuse    = "refresh_token_reuse"
+	RevokedPasswordReset = "password_reset"
+	RevokedPasswordSet   = "password_changed"
+	RevokedAccountDelete = "account_deleted"
+	RevokedAccountOff    = "account_disabled"
+	RevokedRoleChange    = "role_changed"
+	RevokedByAdmin       = "revoked_by_admin"
+	RevokedMFAChange     = "mfa_changed"
+)
+
+// SessionRepository stores login sessions, one refresh-token family each.
+type SessionRepository interface {
+	UserDataEraser
+	Create(ctx context.Context, session models.Session) error
+	// Get returns the session even when it is revoked or expired, so that
+	// callers can tell a replayed token from an unknown one.
+	Get(ctx context.Context, sessionID string) (models.Session, error)
+	// ListActive returns the user's sessions that are neither revoked nor
+	// expired, most recently used first.
+	ListActive(ctx context.Context, userID string) ([]models.Session, error)
+	// Rotate replaces the current refresh token ID, but only if it is still
+	// oldRefreshID and the session is not revoked. Otherwise it returns
+	// ErrNotFound, so two concurrent refreshes cannot both succeed.
+	Rotate(ctx context.Context, sessionID, oldRefreshID, newRefreshID string, usedAt, expiresAt time.Time) error
+	Revoke(ctx context.Context, sessionID, reason string, at time.Time) error
+	// RevokeAll revokes every active session of the user and returns how
+	// many were revoked.
+	RevokeAll(ctx context.Context, userID, reason string, at time.Time) (int64, error)
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// UserPatch holds the profile fields to change; nil fields are left as is.
+type UserPatch struct {
+	FirstName *string
+	LastName  *string
+}
+
+// Account states for UserFilter.Status.
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusDeleted  = "deleted"
+)
+
+// UserFilter narrows an admin user listing. Empty fields match everything.
+type UserFilter struct {
+	// Search matches a case-insensitive substring of the name or email.
+	Search string
+	Role   string
+	Status string
+}
+
+// UserQuery is a page of an admin user listing, newest accounts first.
+type UserQuery struct {
+	Filter UserFilter
+	Skip   int
+	Limit  int
+}
+
+// UserPage is the result of UserRepository.List.
+type UserPage struct {
+	Users []models.User
+	Total int64
+}
+
+// UserDataEraser deletes everything a store keeps about one user. Account
+// erasure calls every repository in Repositories that implements it, so a
+// new store of per-user data only has to implement EraseUser.
+type UserDataEraser interface {
+	EraseUser(ctx context.Context, userID string) error
+}
+
+// UserEmailEraser deletes what a store keeps about one user under their email
+// address rather than their ID. Account erasure calls it like UserDataEraser.
+type UserEmailEraser interface {
+	EraseEmail(ctx context.Context, email string) error
+}
+
+// UserRepository stores user accounts.
+type UserRepository interface {
+	// Create inserts a user and returns it with its ID set. It returns
+	// ErrDuplicate when the email is already registered.
+	Create(ctx context.Context, user models.User) (models.User, error)
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	GetByUserID(ctx context.Context, userID string) (models.User, error)
+	UpdateFavouriteGenres(ctx context.Context, userID string, genres []models.Genre) error
+	// UpdatePassword stores a new password hash.
+	UpdatePassword(ctx context.Context, userID, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userID string, at time.Time) error
+	UpdateProfile(ctx context.Context, userID string, patch UserPatch) (models.User, error)
+	// SoftDelete marks the account deleted. It returns ErrNotFound if the
+	// account does not exist or is already deleted.
+	SoftDelete(ctx context.Context, userID string, at time.Time) error
+	// DeletedBefore returns the soft-deleted accounts that were deleted at or
+	// before cutoff and are not anonymised yet.
+	DeletedBefore(ctx context.Context, cutoff time.Time) ([]models.User, error)
+	// Anonymise replaces the personal data of a soft-deleted account. The
+	// user ID is kept so that references to it stay valid.
+	Anonymise(ctx context.Context, userID string, at time.Time) error
+	List(ctx context.Context, q UserQuery) (UserPage, error)
+	SetRole(ctx context.Context, userID, role string) error
+	// SetDisabled disables or re-enables the account.
+	SetDisabled(ctx context.Context, userID string, disabled bool, at time.Time) error
+	// SetMFA replaces the user's two-factor settings; nil removes them.
+	SetMFA(ctx context.Context, userID string, mfa *models.UserMFA) error
+	// UseTOTPStep records that a code of the given time step was accepted.
+	// It returns ErrNotFound if a code of that step or a later one was
+	// already used, so each code works once.
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode removes the recovery code with the given hash, or
+	// returns ErrNotFound if the user has no such code.
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+}
+
+// AnonymousEmail is the placeholder email of an anonymised account. It stays
+// unique, so the unique index on email keeps working.
+func AnonymousEmail(userID string) string {
+	return "deleted-" + userID + "@deleted.invalid"
+}
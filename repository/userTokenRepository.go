@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// UserTokenRepository stores hashed single-use tokens such as password
+// reset links.
+type UserTokenRepository interface {
+	UserDataEraser
+	Create(ctx context.Context, token models.UserToken) error
+	// Consume deletes and returns the unexpired token with the given purpose
+	// and hash. Only one caller can consume a token; the others, and any
+	// caller with an expired token, get ErrNotFound.
+	Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (models.UserToken, error)
+	// Latest returns the user's most recently created token for purpose.
+	Latest(ctx context.Context, userID, purpose string) (models.UserToken, error)
+	// DeleteForUser removes the user's outstanding tokens for purpose.
+	DeleteForUser(ctx context.Context, userID, purpose string) error
+}
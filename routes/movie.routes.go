@@ -4,30 +4,55 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/samrato/magicstream/controllers"
 	"github.com/samrato/magicstream/middleware"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
 )
 
-func MovieRoutes(router *gin.Engine, client *mongo.Client) {
+func MovieRoutes(router *gin.Engine, repos *repository.Repositories, policy *utils.Policy, classifier utils.SentimentClassifier, queue *utils.JobQueue) {
 	// ================= PUBLIC ROUTES =================
-	router.GET("/movies", controllers.GetMovies(client))
-	router.GET("/movies/:imdb_id", controllers.GetMovie(client))
-	router.GET("/movies/recommended", controllers.GetRecommendedMovies(client))
-	router.GET("/genres", controllers.GetGenres(client))
+	router.GET("/movies", controllers.GetMovies(repos.Movies))
+	router.GET("/movies/:imdb_id", controllers.GetMovie(repos.Movies))
+	router.GET("/movies/search", controllers.SearchMovies(repos.Movies))
+	router.GET("/movies/recommended", controllers.GetRecommendedMovies(repos.Movies, repos.Users))
+	router.GET("/genres", controllers.GetGenres(repos.Genres))
 
 	// ================= AUTHENTICATED ROUTES =================
 	auth := router.Group("/")
-	auth.Use(middleware.AuthMiddleware()) // require login
+	auth.Use(
+		middleware.AcceptAPIKeys(repos.APIKeys, repos.Users),
+		middleware.AuthMiddleware(repos.Denylist), // require login
+		middleware.RequireVerifiedEmail(repos.Users),
+	)
 	{
-		auth.POST("/movies", controllers.AddMovie(client))
+		auth.POST("/movies", middleware.RequireScope(utils.PermMoviesWrite), controllers.AddMovie(repos.Movies))
 	}
 
 	// ================= ADMIN ROUTES =================
+	// Each route requires its own permission, see utils/rbac.go
 	admin := router.Group("/admin")
 	admin.Use(
-		middleware.AuthMiddleware(),  
-		middleware.AdminOnly(),       
+		middleware.AcceptAPIKeys(repos.APIKeys, repos.Users),
+		middleware.AuthMiddleware(repos.Denylist),
+		middleware.RequireVerifiedEmail(repos.Users),
 	)
 	{
-		admin.PUT("/movies/:imdb_id/review", controllers.AdminReviewUpdate(client))
+		canReview := middleware.RequirePermission(policy, utils.PermReviewsWrite)
+		canWrite := middleware.RequirePermission(policy, utils.PermMoviesWrite)
+		canExport := middleware.RequirePermission(policy, utils.PermCatalogExport)
+
+		admin.PUT("/movies/:imdb_id/review", canReview, controllers.AdminReviewUpdate(repos.Movies, repos.Rankings, classifier, queue))
+		admin.PATCH("/movies/:imdb_id", canWrite, controllers.UpdateMovie(repos.Movies))
+		admin.DELETE("/movies/:imdb_id", canWrite, controllers.DeleteMovie(repos.Movies))
+		admin.POST("/movies/:imdb_id/restore", canWrite, controllers.RestoreMovie(repos.Movies))
+		admin.POST("/movies/purge", canWrite, controllers.PurgeMovies(repos.Movies))
+		admin.POST("/movies/import", canWrite, controllers.ImportMoviesHandler(repos.Movies))
+		admin.GET("/export/:collection", canExport, controllers.ExportCollection(repos))
+
+		// Background jobs, such as review rankings
+		admin.GET("/jobs", canReview, controllers.ListJobs(repos.Jobs))
+		admin.GET("/jobs/:job_id", canReview, controllers.GetJob(repos.Jobs))
+		admin.POST("/jobs/:job_id/retry", canReview, controllers.RetryJob(queue))
+		admin.POST("/rerank", canReview, controllers.StartRerank(repos.Jobs, queue))
+		admin.GET("/rerank/:job_id/changes", canReview, controllers.GetRerankChanges(repos.Reranks))
 	}
 }
@@ -0,0 +1,134 @@
+package routes_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+func testMovie(imdbID, title string, ranking int, genres ...string) models.Movie {
+	m := models.Movie{
+		ImdbID:     imdbID,
+		Title:      title,
+		PosterPath: "https://example.com/" + imdbID + ".jpg",
+		YouTubeID:  "yt" + imdbID,
+		Ranking:    models.Ranking{RankingValue: ranking, RankingName: "Good"},
+	}
+	for i, name := range genres {
+		m.Genres = append(m.Genres, models.Genre{GenreID: i + 1, GenreName: name})
+	}
+	return m
+}
+
+func titles(t *testing.T, out map[string]any) []string {
+	t.Helper()
+	var got []string
+	for _, m := range out["data"].([]any) {
+		got = append(got, m.(map[string]any)["title"].(string))
+	}
+	return got
+}
+
+func TestMovieCRUD(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.admin("admin@example.com")
+	movie := testMovie("tt0000001", "The Matrix", 1, "Action")
+
+	s.expect(s.do(http.MethodPost, "/movies", "", movie), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/movies", admin, movie), http.StatusCreated)
+	s.expect(s.do(http.MethodPost, "/movies", admin, movie), http.StatusConflict)
+	s.expect(s.do(http.MethodPost, "/movies", admin, map[string]string{"imdb_id": "tt0000002"}), http.StatusBadRequest)
+
+	got := s.expect(s.do(http.MethodGet, "/movies/tt0000001", "", nil), http.StatusOK)
+	if got["title"] != "The Matrix" {
+		t.Fatalf("title = %v", got["title"])
+	}
+	s.expect(s.do(http.MethodGet, "/movies/tt9999999", "", nil), http.StatusNotFound)
+
+	got = s.expect(s.do(http.MethodPatch, "/admin/movies/tt0000001", admin, map[string]string{"title": "The Matrix Reloaded"}), http.StatusOK)
+	if got["title"] != "The Matrix Reloaded" {
+		t.Fatalf("patched title = %v", got["title"])
+	}
+
+	s.expect(s.do(http.MethodDelete, "/admin/movies/tt0000001", admin, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/movies/tt0000001", "", nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, "/admin/movies/tt0000001", admin, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodPost, "/admin/movies/tt0000001/restore", admin, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/movies/tt0000001", "", nil), http.StatusOK)
+}
+
+func TestMovieAdminRoutesNeedPermission(t *testing.T) {
+	s := newTestServer(t)
+	token, _, _ := s.register("user@example.com")
+	if _, err := s.repos.Movies.Create(context.Background(), testMovie("tt0000001", "Alien", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expect(s.do(http.MethodPatch, "/admin/movies/tt0000001", "", map[string]string{"title": "Aliens"}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPatch, "/admin/movies/tt0000001", token, map[string]string{"title": "Aliens"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, "/admin/movies/tt0000001", token, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodGet, "/movies/tt0000001", "", nil), http.StatusOK)
+}
+
+func TestListMovies(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	seed := []models.Movie{
+		testMovie("tt0000001", "Heat", 3, "Crime"),
+		testMovie("tt0000002", "Alien", 1, "Horror"),
+		testMovie("tt0000003", "Drive", 2, "Crime"),
+		testMovie("tt0000004", "Casablanca", 5, "Drama"),
+		testMovie("tt0000005", "Brazil", 4, "Comedy"),
+	}
+	for _, m := range seed {
+		if _, err := s.repos.Movies.Create(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.repos.Movies.SoftDelete(ctx, "tt0000005", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	out := s.expect(s.do(http.MethodGet, "/movies?sort=title&limit=2", "", nil), http.StatusOK)
+	if got := fmt.Sprint(titles(t, out)); got != "[Alien Casablanca]" {
+		t.Fatalf("page 1 = %s", got)
+	}
+	if out["total"] != float64(4) || out["total_pages"] != float64(2) || out["next"] == nil {
+		t.Fatalf("page 1 meta = total %v, pages %v, next %v", out["total"], out["total_pages"], out["next"])
+	}
+
+	out = s.expect(s.do(http.MethodGet, "/movies?sort=title&limit=2&page=2", "", nil), http.StatusOK)
+	if got := fmt.Sprint(titles(t, out)); got != "[Drive Heat]" {
+		t.Fatalf("page 2 = %s", got)
+	}
+	if out["next"] != nil {
+		t.Fatalf("page 2 next = %v", out["next"])
+	}
+
+	out = s.expect(s.do(http.MethodGet, "/movies?sort=ranking&order=desc&limit=2", "", nil), http.StatusOK)
+	if got := fmt.Sprint(titles(t, out)); got != "[Casablanca Heat]" {
+		t.Fatalf("by ranking = %s", got)
+	}
+	cursor := out["next_cursor"].(string)
+	out = s.expect(s.do(http.MethodGet, "/movies?sort=ranking&order=desc&limit=2&cursor="+url.QueryEscape(cursor), "", nil), http.StatusOK)
+	if got := fmt.Sprint(titles(t, out)); got != "[Drive Alien]" {
+		t.Fatalf("after cursor = %s", got)
+	}
+
+	out = s.expect(s.do(http.MethodGet, "/movies?genre=Crime&sort=title", "", nil), http.StatusOK)
+	if got := fmt.Sprint(titles(t, out)); got != "[Drive Heat]" {
+		t.Fatalf("genre filter = %s", got)
+	}
+	out = s.expect(s.do(http.MethodGet, "/movies?ranking_min=2&ranking_max=3&sort=title", "", nil), http.StatusOK)
+	if got := fmt.Sprint(titles(t, out)); got != "[Drive Heat]" {
+		t.Fatalf("ranking filter = %s", got)
+	}
+
+	s.expect(s.do(http.MethodGet, "/movies?sort=year", "", nil), http.StatusBadRequest)
+	s.expect(s.do(http.MethodGet, "/movies?sort=title&cursor="+url.QueryEscape(cursor), "", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,140 @@
+package routes_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/routes"
+	"github.com/samrato/magicstream/utils"
+)
+
+// testServer is the whole HTTP API over in-memory repositories, wired the
+// way main does with STORAGE_BACKEND=memory.
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	repos  *repository.Repositories
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MAIL_DRIVER", "outbox")
+	t.Setenv("MAIL_OUTBOX_DIR", t.TempDir())
+	t.Setenv("SENTIMENT_PROVIDER", "lexicon")
+
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+	keyring := utils.NewKeyring(repos.Keys, utils.KeyringConfig{
+		Algorithm:      "EdDSA",
+		RotationPeriod: time.Hour,
+		Retention:      time.Hour,
+		EncryptionKey:  kek,
+	})
+	if err := keyring.Load(ctx); err != nil {
+		t.Fatalf("load keyring: %v", err)
+	}
+	utils.UseKeyring(keyring)
+
+	policy := utils.NewPolicy(repos.Roles)
+	if err := policy.Load(ctx); err != nil {
+		t.Fatalf("load roles: %v", err)
+	}
+	mailer, err := utils.NewMailerFromEnv()
+	if err != nil {
+		t.Fatalf("mailer: %v", err)
+	}
+	classifier, err := utils.NewSentimentClassifierFromEnv()
+	if err != nil {
+		t.Fatalf("classifier: %v", err)
+	}
+	queue := utils.NewJobQueue(repos.Jobs, utils.JobQueueConfig{})
+
+	router := gin.New()
+	routes.WellKnownRoutes(router, keyring)
+	routes.MovieRoutes(router, repos, policy, classifier, queue)
+	routes.UserRoutes(router, repos, mailer, policy, utils.OIDCProviders{})
+	return &testServer{t: t, router: router, repos: repos}
+}
+
+// do sends a request with an optional bearer token and JSON body.
+func (s *testServer) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// expect fails the test unless w has the given status, and returns its JSON
+// body.
+func (s *testServer) expect(w *httptest.ResponseRecorder, status int) map[string]any {
+	s.t.Helper()
+	if w.Code != status {
+		s.t.Fatalf("got status %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+	out := map[string]any{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		s.t.Fatalf("decode response: %v: %s", err, w.Body.String())
+	}
+	return out
+}
+
+// register creates a verified account and returns its tokens and user ID.
+func (s *testServer) register(email string) (token, refresh, userID string) {
+	s.t.Helper()
+	out := s.expect(s.do(http.MethodPost, "/users/register", "", map[string]any{
+		"first_name": "Ada",
+		"last_name":  "Lovelace",
+		"email":      email,
+		"password":   "secret123",
+	}), http.StatusCreated)
+	userID = out["user_id"].(string)
+	if err := s.repos.Users.MarkEmailVerified(context.Background(), userID, time.Now()); err != nil {
+		s.t.Fatal(err)
+	}
+	return out["token"].(string), out["refresh_token"].(string), userID
+}
+
+// login returns a fresh access token for email.
+func (s *testServer) login(email string) string {
+	s.t.Helper()
+	out := s.expect(s.do(http.MethodPost, "/users/login", "", map[string]string{
+		"email":    email,
+		"password": "secret123",
+	}), http.StatusOK)
+	return out["token"].(string)
+}
+
+// admin registers an account with the ADMIN role and returns its token.
+func (s *testServer) admin(email string) string {
+	s.t.Helper()
+	_, _, userID := s.register(email)
+	if err := s.repos.Users.SetRole(context.Background(), userID, utils.AdminRole); err != nil {
+		s.t.Fatal(err)
+	}
+	return s.login(email)
+}
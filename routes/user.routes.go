@@ -4,36 +4,85 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/samrato/magicstream/controllers"
 	"github.com/samrato/magicstream/middleware"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/samrato/magicstream/repository"
+	"github.com/samrato/magicstream/utils"
 )
 
-func UserRoutes(router *gin.Engine, client *mongo.Client) {
+func UserRoutes(router *gin.Engine, repos *repository.Repositories, mailer utils.Mailer, policy *utils.Policy, providers utils.OIDCProviders) {
 	// ================= PUBLIC ROUTES =================
 	public := router.Group("/users")
 	{
-		public.POST("/register", controllers.RegisterUser(client))
-		public.POST("/login", controllers.LoginUser(client))
-		public.POST("/refresh-token", controllers.RefreshTokenHandler())
+		public.POST("/register", controllers.RegisterUser(repos.Users, repos.Sessions, repos.Tokens, mailer, policy))
+		public.POST("/login", controllers.LoginUser(repos.Users, repos.Sessions, repos.LoginAttempts))
+		public.POST("/login/mfa", controllers.LoginMFA(repos.Users, repos.Sessions, repos.Denylist, repos.LoginAttempts))
+		public.POST("/refresh-token", controllers.RefreshTokenHandler(repos.Users, repos.Sessions, repos.Denylist))
+		public.POST("/password/forgot", controllers.ForgotPassword(repos.Users, repos.Tokens, repos.LoginAttempts, mailer))
+		public.POST("/password/reset", controllers.ResetPassword(repos.Users, repos.Tokens, repos.Sessions, repos.Denylist, repos.LoginAttempts))
+		public.POST("/email/verify", controllers.VerifyEmail(repos.Users, repos.Tokens))
+		public.GET("/oidc/providers", controllers.ListOIDCProviders(providers))
+		public.POST("/oidc/:provider/start", controllers.StartOIDCLogin(providers, repos.OIDCFlows))
+		public.POST("/oidc/:provider/callback", controllers.OIDCCallback(repos.Users, repos.Identities, repos.OIDCFlows, repos.Sessions, providers, policy))
 	}
 
 	// ================= AUTHENTICATED ROUTES =================
 	auth := router.Group("/users")
-	auth.Use(middleware.AuthMiddleware())
+	auth.Use(middleware.AuthMiddleware(repos.Denylist))
 	{
-		auth.GET("/profile", controllers.GetUserProfile(client))
-		auth.PUT("/favourite-genres", controllers.UpdateFavouriteGenres(client))
-		auth.POST("/logout", controllers.LogoutHandler())
+		auth.GET("/profile", controllers.GetUserProfile(repos.Users, policy))
+		auth.PATCH("/profile", controllers.UpdateProfile(repos.Users))
+		auth.PUT("/password", controllers.ChangePassword(repos.Users, repos.Sessions, repos.Denylist))
+		auth.DELETE("/me", controllers.DeleteAccount(repos.Users, repos.Sessions, repos.Denylist))
+		auth.POST("/email/resend", controllers.ResendVerification(repos.Users, repos.Tokens, mailer))
+		auth.POST("/logout", controllers.LogoutHandler(repos.Sessions, repos.Denylist))
+		auth.GET("/sessions", controllers.GetSessions(repos.Sessions))
+		auth.DELETE("/sessions/:session_id", controllers.RevokeSession(repos.Sessions, repos.Denylist))
+		auth.GET("/mfa", controllers.GetMFAStatus(repos.Users, policy))
+		auth.POST("/mfa/totp/enroll", controllers.EnrollTOTP(repos.Users, repos.Sessions))
+		auth.POST("/mfa/totp/verify", controllers.VerifyTOTP(repos.Users, repos.Sessions, repos.Denylist))
+		auth.DELETE("/mfa/totp", controllers.DisableTOTP(repos.Users, repos.Sessions, repos.Denylist, policy))
+		auth.POST("/mfa/recovery-codes", controllers.RegenerateRecoveryCodes(repos.Users))
+		auth.GET("/identities", controllers.ListIdentities(repos.Identities))
+		auth.POST("/identities/:provider", controllers.LinkIdentity(providers, repos.OIDCFlows))
+		auth.DELETE("/identities/:provider", controllers.UnlinkIdentity(repos.Users, repos.Identities))
+	}
+
+	// ================= VERIFIED EMAIL ROUTES =================
+	verified := router.Group("/users")
+	verified.Use(middleware.AuthMiddleware(repos.Denylist), middleware.RequireVerifiedEmail(repos.Users))
+	{
+		verified.PUT("/favourite-genres", controllers.UpdateFavouriteGenres(repos.Users))
 	}
 
 	// ================= ADMIN ROUTES =================
-	// Example: if you want admin-only user actions in future
-	admin := router.Group("/admin/users")
+	// Every admin route checks a permission, so API keys are accepted here
+	admin := router.Group("/admin")
 	admin.Use(
-		middleware.AuthMiddleware(),
-		middleware.AdminOnly(),
+		middleware.AcceptAPIKeys(repos.APIKeys, repos.Users),
+		middleware.AuthMiddleware(repos.Denylist),
 	)
 	{
-		// e.g., get all users, delete users, etc.
-		// admin.GET("/", controllers.GetAllUsers(client))
+		canRead := middleware.RequirePermission(policy, utils.PermUsersRead)
+		canLogout := middleware.RequirePermission(policy, utils.PermUsersSessions)
+		canManage := middleware.RequirePermission(policy, utils.PermUsersManage)
+		canManageRoles := middleware.RequirePermission(policy, utils.PermRolesManage)
+		canManageKeys := middleware.RequirePermission(policy, utils.PermAPIKeysManage)
+
+		admin.GET("/users", canRead, controllers.ListUsers(repos.Users))
+		admin.GET("/users/:user_id", canRead, controllers.GetUserDetail(repos.Users, repos.Sessions, repos.Audit, repos.LoginAttempts))
+		admin.GET("/users/:user_id/audit", canRead, controllers.GetUserAuditLog(repos.Audit))
+		admin.PUT("/users/:user_id/role", canManage, controllers.UpdateUserRole(repos.Users, repos.Sessions, repos.Denylist, repos.Audit, policy))
+		admin.POST("/users/:user_id/disable", canManage, controllers.DisableUser(repos.Users, repos.Sessions, repos.Denylist, repos.Audit, policy))
+		admin.POST("/users/:user_id/enable", canManage, controllers.EnableUser(repos.Users, repos.Audit, policy))
+		admin.POST("/users/:user_id/unlock", canManage, controllers.UnlockUser(repos.Users, repos.LoginAttempts, repos.Audit))
+		admin.DELETE("/users/:user_id/mfa", canManage, controllers.ResetUserMFA(repos.Users, repos.Sessions, repos.Denylist, repos.Audit, policy))
+		admin.POST("/users/:user_id/logout", canLogout, controllers.ForceLogoutUser(repos.Users, repos.Sessions, repos.Denylist, repos.Audit, policy))
+
+		admin.GET("/roles", canManageRoles, controllers.ListRoles(policy))
+		admin.PUT("/roles/:name", canManageRoles, controllers.SaveRole(policy, repos.Audit))
+		admin.DELETE("/roles/:name", canManageRoles, controllers.DeleteRole(policy, repos.Users, repos.Audit))
+
+		admin.GET("/api-keys", canManageKeys, controllers.ListAPIKeys(repos.APIKeys, repos.Users, policy))
+		admin.POST("/api-keys", canManageKeys, controllers.CreateAPIKey(repos.APIKeys, repos.Audit, policy))
+		admin.DELETE("/api-keys/:key_id", canManageKeys, controllers.RevokeAPIKey(repos.APIKeys, repos.Users, repos.Audit, policy))
 	}
 }
@@ -0,0 +1,62 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRegisterLoginRefresh(t *testing.T) {
+	s := newTestServer(t)
+	register := map[string]any{
+		"first_name": "Grace",
+		"last_name":  "Hopper",
+		"email":      "grace@example.com",
+		"password":   "secret123",
+	}
+
+	out := s.expect(s.do(http.MethodPost, "/users/register", "", register), http.StatusCreated)
+	if out["email"] != "grace@example.com" || out["token"] == "" || out["refresh_token"] == "" {
+		t.Fatalf("register response = %v", out)
+	}
+	s.expect(s.do(http.MethodPost, "/users/register", "", register), http.StatusConflict)
+	s.expect(s.do(http.MethodPost, "/users/register", "", map[string]string{"email": "not-an-email"}), http.StatusBadRequest)
+
+	s.expect(s.do(http.MethodPost, "/users/login", "", map[string]string{
+		"email":    "grace@example.com",
+		"password": "wrong-password",
+	}), http.StatusUnauthorized)
+	out = s.expect(s.do(http.MethodPost, "/users/login", "", map[string]string{
+		"email":    "grace@example.com",
+		"password": "secret123",
+	}), http.StatusOK)
+	token, refresh := out["token"].(string), out["refresh_token"].(string)
+
+	out = s.expect(s.do(http.MethodGet, "/users/profile", token, nil), http.StatusOK)
+	if out["email"] != "grace@example.com" {
+		t.Fatalf("profile email = %v", out["email"])
+	}
+	s.expect(s.do(http.MethodGet, "/users/profile", "", nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/users/profile", "not-a-token", nil), http.StatusUnauthorized)
+
+	// Refresh tokens rotate: the new pair works, and replaying the old
+	// token ends the whole session
+	out = s.expect(s.do(http.MethodPost, "/users/refresh-token", refresh, nil), http.StatusOK)
+	rotated := out["refresh_token"].(string)
+	if rotated == refresh {
+		t.Fatal("refresh token was not rotated")
+	}
+	s.expect(s.do(http.MethodGet, "/users/profile", out["token"].(string), nil), http.StatusOK)
+
+	s.expect(s.do(http.MethodPost, "/users/refresh-token", refresh, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/users/refresh-token", rotated, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/users/refresh-token", "", nil), http.StatusUnauthorized)
+}
+
+func TestLogoutEndsSession(t *testing.T) {
+	s := newTestServer(t)
+	token, refresh, _ := s.register("alan@example.com")
+
+	s.expect(s.do(http.MethodPost, "/users/logout", token, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/users/profile", token, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/users/refresh-token", refresh, nil), http.StatusUnauthorized)
+}
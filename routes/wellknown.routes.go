@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/samrato/magicstream/controllers"
+	"github.com/samrato/magicstream/utils"
+)
+
+func WellKnownRoutes(router *gin.Engine, keyring *utils.Keyring) {
+	// ================= PUBLIC ROUTES =================
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS(keyring))
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ================= CALLBACK TARGETS =================
+
+// Callbacks are requested by API callers but sent from inside the server, so
+// they must not reach the server's own network: loopback, private ranges,
+// link-local addresses such as the cloud metadata endpoint, and the like.
+
+var errCallbackTarget = errors.New("callback_url must point to a public address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which some clouds use
+// for internal services.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether addr is routable on the public internet.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!sharedAddressSpace.Contains(addr) &&
+		!(addr.Is4() && addr.As4()[0] == 0)
+}
+
+// ValidateCallbackURL checks that raw is an absolute http or https URL the
+// queue may call back. Hosts given as IP addresses must be public; names are
+// checked again once resolved, when the callback is sent.
+func (q *JobQueue) ValidateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return errors.New("callback_url must be an absolute http or https URL")
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(q.cfg.CallbackHosts) > 0 && !slices.Contains(q.cfg.CallbackHosts, host) {
+		return errors.New("callback_url host is not allowed")
+	}
+	if q.cfg.CallbackAllowPrivate {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errCallbackTarget
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return errCallbackTarget
+	}
+	return nil
+}
+
+// newCallbackClient returns the client callbacks are sent with. Unless
+// allowPrivate is set, it refuses to connect to addresses that are not public
+// whatever the host name resolves to, and it never follows redirects or
+// goes through a proxy.
+func newCallbackClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(ap.Addr()) {
+				return errCallbackTarget
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
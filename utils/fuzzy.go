@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ================= NORMALISATION =================
+
+// Normalize lower-cases s and replaces everything that is not a letter or a
+// digit with a single space.
+func Normalize(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space && b.Len() > 0 {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Tokenize splits s into normalised words.
+func Tokenize(s string) []string {
+	return strings.Fields(Normalize(s))
+}
+
+// ================= EDIT DISTANCE =================
+
+// Levenshtein returns the edit distance between a and b, counted in runes.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+	if len(rb) == 0 {
+		return len(ra)
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// Similarity returns a score between 0 and 1, where 1 means a and b are equal.
+func Similarity(a, b string) float64 {
+	la, lb := len([]rune(a)), len([]rune(b))
+	longest := max(la, lb)
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(Levenshtein(a, b))/float64(longest)
+}
+
+// MaxTypos is the number of edits tolerated for a search term of this length.
+func MaxTypos(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// ================= MATCHING =================
+
+// TermScore scores how well word matches a normalised search term: 1 for an
+// exact match, slightly less for a prefix, and less again for a typo within
+// MaxTypos. It returns 0 when the word does not match.
+func TermScore(word, term string) float64 {
+	if word == term {
+		return 1
+	}
+	if len([]rune(term)) >= 3 && strings.HasPrefix(word, term) {
+		return 0.9
+	}
+	if d := Levenshtein(word, term); d <= MaxTypos(term) {
+		return 0.8 * Similarity(word, term)
+	}
+	return 0
+}
+
+// FuzzyScore returns the average best TermScore of every term against the
+// words of text, so 1 means every term appears verbatim.
+func FuzzyScore(terms []string, text string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	words := Tokenize(text)
+
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, w := range words {
+			if s := TermScore(w, term); s > best {
+				best = s
+				if best == 1 {
+					break
+				}
+			}
+		}
+		total += best
+	}
+	return total / float64(len(terms))
+}
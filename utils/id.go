@@ -0,0 +1,11 @@
+package utils
+
+import "github.com/google/uuid"
+
+// ================= ID GENERATION =================
+
+// GenerateID returns a new UUIDv7. Its leading timestamp keeps IDs roughly
+// sorted by creation time, which keeps the unique index on user_id compact.
+func GenerateID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
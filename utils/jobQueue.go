@@ -0,0 +1,402 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// ================= JOB QUEUE =================
+
+// JobStore persists background jobs. Methods that change a claimed job only
+// apply while worker still holds its lease, and fail otherwise.
+type JobStore interface {
+	CreateJob(ctx context.Context, job models.Job) error
+	GetJob(ctx context.Context, jobID string) (models.Job, error)
+	ListJobs(ctx context.Context, filter JobFilter) ([]models.Job, error)
+	// ClaimJob leases the job that is due first to worker until now+lease,
+	// counting an attempt. Running jobs whose lease ran out are claimed
+	// again. found is false when no job is due.
+	ClaimJob(ctx context.Context, worker string, now time.Time, lease time.Duration) (job models.Job, found bool, err error)
+	// ExtendJobLease keeps a job claimed by worker until until.
+	ExtendJobLease(ctx context.Context, jobID, worker string, until time.Time) error
+	SetJobProgress(ctx context.Context, jobID, worker string, progress models.JobProgress) error
+	CompleteJob(ctx context.Context, jobID, worker string, result map[string]string, now time.Time) error
+	RetryJob(ctx context.Context, jobID, worker, lastErr string, runAt, now time.Time) error
+	// BuryJob dead-letters the job: it stays stored but is never run again
+	// unless requeued.
+	BuryJob(ctx context.Context, jobID, worker, lastErr string, now time.Time) error
+	// RequeueJob makes a dead job run again with fresh attempts.
+	RequeueJob(ctx context.Context, jobID string, now time.Time) error
+	SetJobCallbackStatus(ctx context.Context, jobID, status string) error
+}
+
+// JobFilter narrows ListJobs. Empty fields match everything; results are
+// newest first.
+type JobFilter struct {
+	Type   string
+	Status string
+	Limit  int
+}
+
+// JobHandler runs one job and returns the result stored with it. Returning
+// an error schedules a retry, unless it is wrapped with PermanentJobError.
+type JobHandler func(ctx context.Context, job models.Job) (map[string]string, error)
+
+type permanentJobError struct{ err error }
+
+func (e permanentJobError) Error() string { return e.err.Error() }
+func (e permanentJobError) Unwrap() error { return e.err }
+
+// PermanentJobError marks err as not worth retrying; the job is dead-lettered
+// right away.
+func PermanentJobError(err error) error { return permanentJobError{err} }
+
+// JobQueueConfig controls the workers of a JobQueue.
+type JobQueueConfig struct {
+	Workers     int
+	MaxAttempts int
+	// Lease is how long a worker may go without renewing its claim on a job
+	// before another worker assumes it died and takes the job over. Running
+	// jobs renew it every third of the lease.
+	Lease        time.Duration
+	PollInterval time.Duration
+	// Retries wait BaseBackoff, doubling per attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// CallbackSecret signs callback bodies when set.
+	CallbackSecret string
+	// CallbackHosts, when set, are the only hosts callbacks may go to.
+	CallbackHosts []string
+	// CallbackAllowPrivate lets callbacks reach loopback, private and
+	// link-local addresses, which are refused by default.
+	CallbackAllowPrivate bool
+}
+
+// JobQueueConfigFromEnv reads JOB_WORKERS, JOB_MAX_ATTEMPTS,
+// JOB_CALLBACK_SECRET, JOB_CALLBACK_HOSTS and JOB_CALLBACK_ALLOW_PRIVATE.
+func JobQueueConfigFromEnv() JobQueueConfig {
+	cfg := JobQueueConfig{
+		Workers:        2,
+		MaxAttempts:    5,
+		Lease:          5 * time.Minute,
+		PollInterval:   2 * time.Second,
+		BaseBackoff:    10 * time.Second,
+		MaxBackoff:     10 * time.Minute,
+		CallbackSecret: os.Getenv("JOB_CALLBACK_SECRET"),
+	}
+	if n, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && n >= 0 {
+		cfg.Workers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("JOB_MAX_ATTEMPTS")); err == nil && n >= 1 {
+		cfg.MaxAttempts = n
+	}
+	for _, host := range strings.Split(os.Getenv("JOB_CALLBACK_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			cfg.CallbackHosts = append(cfg.CallbackHosts, host)
+		}
+	}
+	cfg.CallbackAllowPrivate = os.Getenv("JOB_CALLBACK_ALLOW_PRIVATE") == "true"
+	return cfg
+}
+
+// JobQueue stores jobs in a JobStore and runs them on worker goroutines.
+// Several API instances can share one store; leases keep them from running
+// the same job twice.
+type JobQueue struct {
+	store    JobStore
+	cfg      JobQueueConfig
+	handlers map[string]JobHandler
+	onDead   map[string]func(ctx context.Context, job models.Job)
+	wake     chan struct{}
+	instance string
+	client   *http.Client
+}
+
+// NewJobQueue returns a queue over store. Register handlers with Handle
+// before calling Run.
+func NewJobQueue(store JobStore, cfg JobQueueConfig) *JobQueue {
+	host, _ := os.Hostname()
+	id := GenerateID()
+	return &JobQueue{
+		store:    store,
+		cfg:      cfg,
+		handlers: map[string]JobHandler{},
+		onDead:   map[string]func(ctx context.Context, job models.Job){},
+		wake:     make(chan struct{}, 1),
+		instance: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), id[len(id)-8:]),
+		client:   newCallbackClient(cfg.CallbackAllowPrivate),
+	}
+}
+
+// Handle registers the handler for jobs of jobType.
+func (q *JobQueue) Handle(jobType string, h JobHandler) {
+	q.handlers[jobType] = h
+}
+
+// OnDead registers fn to run when a job of jobType is dead-lettered, for
+// example to record the failure where users will see it.
+func (q *JobQueue) OnDead(jobType string, fn func(ctx context.Context, job models.Job)) {
+	q.onDead[jobType] = fn
+}
+
+// Enqueue stores job, which needs at least a Type and Payload, and wakes an
+// idle worker. A JobID is generated unless set, which lets callers record it
+// elsewhere before any worker can pick the job up.
+func (q *JobQueue) Enqueue(ctx context.Context, job models.Job) (models.Job, error) {
+	now := time.Now()
+	if job.JobID == "" {
+		job.JobID = GenerateID()
+	}
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = q.cfg.MaxAttempts
+	}
+	job.Status, job.Attempts = models.JobQueued, 0
+	job.RunAt, job.CreatedAt, job.UpdatedAt = now, now, now
+	if err := q.store.CreateJob(ctx, job); err != nil {
+		return models.Job{}, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// Requeue gives a dead job a fresh set of attempts.
+func (q *JobQueue) Requeue(ctx context.Context, jobID string) error {
+	if err := q.store.RequeueJob(ctx, jobID, time.Now()); err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts the workers and blocks until ctx is done.
+func (q *JobQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			q.work(ctx, worker)
+		}(fmt.Sprintf("%s/%d", q.instance, i))
+	}
+	wg.Wait()
+}
+
+func (q *JobQueue) work(ctx context.Context, worker string) {
+	for {
+		claimCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		job, found, err := q.store.ClaimJob(claimCtx, worker, time.Now(), q.cfg.Lease)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to claim job: %v", err)
+		}
+		if found {
+			q.process(ctx, worker, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(q.cfg.PollInterval):
+		}
+	}
+}
+
+// process runs one claimed job and records the outcome.
+func (q *JobQueue) process(ctx context.Context, worker string, job models.Job) {
+	var result map[string]string
+	var err error
+	handler, ok := q.handlers[job.Type]
+	switch {
+	case !ok:
+		err = PermanentJobError(fmt.Errorf("no handler for job type %q", job.Type))
+	case job.Attempts > job.MaxAttempts:
+		// The worker running the last attempt died before recording it
+		err = PermanentJobError(errors.New("attempts exhausted"))
+	default:
+		runCtx, cancel := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			q.renewLease(runCtx, cancel, worker, job.JobID)
+		}()
+		result, err = runJob(runCtx, handler, job)
+		cancel()
+		<-stopped
+	}
+
+	// Record the outcome even if the queue is shutting down
+	storeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	now := time.Now()
+
+	var permanent permanentJobError
+	switch {
+	case err == nil:
+		err = q.store.CompleteJob(storeCtx, job.JobID, worker, result, now)
+		job.Status, job.Result = models.JobSucceeded, result
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		log.Printf("Job %s (%s) failed for good after %d attempts: %v", job.JobID, job.Type, job.Attempts, err)
+		job.Status, job.LastError = models.JobDead, err.Error()
+		err = q.store.BuryJob(storeCtx, job.JobID, worker, job.LastError, now)
+	default:
+		runAt := now.Add(q.backoff(job.Attempts))
+		log.Printf("Job %s (%s) attempt %d failed, retrying at %s: %v", job.JobID, job.Type, job.Attempts, runAt.Format(time.RFC3339), err)
+		if err := q.store.RetryJob(storeCtx, job.JobID, worker, err.Error(), runAt, now); err != nil {
+			log.Printf("Failed to reschedule job %s: %v", job.JobID, err)
+		}
+		return
+	}
+	if err != nil {
+		// Most likely the lease ran out and another worker has the job now
+		log.Printf("Failed to record outcome of job %s: %v", job.JobID, err)
+		return
+	}
+	if fn := q.onDead[job.Type]; fn != nil && job.Status == models.JobDead {
+		fn(storeCtx, job)
+	}
+
+	if job.CallbackURL != "" {
+		job.FinishedAt, job.UpdatedAt = &now, now
+		status := "delivered"
+		if err := q.deliverCallback(ctx, job); err != nil {
+			log.Printf("Failed to deliver callback for job %s: %v", job.JobID, err)
+			status = "failed"
+		}
+		if err := q.store.SetJobCallbackStatus(storeCtx, job.JobID, status); err != nil {
+			log.Printf("Failed to record callback status of job %s: %v", job.JobID, err)
+		}
+	}
+}
+
+// renewLease extends the lease on a running job until ctx is done. If the
+// lease cannot be renewed in time, another worker may take the job over, so
+// the run is cancelled.
+func (q *JobQueue) renewLease(ctx context.Context, cancel context.CancelFunc, worker, jobID string) {
+	ticker := time.NewTicker(q.cfg.Lease / 3)
+	defer ticker.Stop()
+	expires := time.Now().Add(q.cfg.Lease)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		renewCtx, stop := context.WithTimeout(ctx, 10*time.Second)
+		until := time.Now().Add(q.cfg.Lease)
+		err := q.store.ExtendJobLease(renewCtx, jobID, worker, until)
+		stop()
+		switch {
+		case err == nil:
+			expires = until
+		case ctx.Err() != nil:
+			return
+		default:
+			log.Printf("Failed to renew lease on job %s: %v", jobID, err)
+			// Give up before the lease runs out and the job is claimed again
+			if time.Until(expires) < q.cfg.Lease/3 {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// ReportProgress stores progress on a job the calling handler is running.
+func (q *JobQueue) ReportProgress(ctx context.Context, job models.Job, progress models.JobProgress) error {
+	return q.store.SetJobProgress(ctx, job.JobID, job.LockedBy, progress)
+}
+
+// runJob calls handler, turning a panic into an error so one bad job cannot
+// take the worker down.
+func runJob(ctx context.Context, handler JobHandler, job models.Job) (result map[string]string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff returns the delay before the retry following attempt, with jitter
+// so that jobs failing together do not retry together.
+func (q *JobQueue) backoff(attempt int) time.Duration {
+	d := q.cfg.BaseBackoff << min(attempt-1, 20)
+	if d <= 0 || d > q.cfg.MaxBackoff {
+		d = q.cfg.MaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// deliverCallback posts the finished job to its callback URL, trying three
+// times. With a secret configured, the body is signed with HMAC-SHA256 in the
+// X-Signature-256 header as "sha256=<hex>".
+func (q *JobQueue) deliverCallback(ctx context.Context, job models.Job) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	var signature string
+	if q.cfg.CallbackSecret != "" {
+		mac := hmac.New(sha256.New, []byte(q.cfg.CallbackSecret))
+		mac.Write(body)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = q.postCallback(ctx, job, body, signature)
+		if err == nil || attempt == 3 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		}
+	}
+}
+
+func (q *JobQueue) postCallback(ctx context.Context, job models.Job, body []byte, signature string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-ID", job.JobID)
+	if signature != "" {
+		req.Header.Set("X-Signature-256", signature)
+	}
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,492 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/samrato/magicstream/models"
+)
+
+// ================= SIGNING ALGORITHMS =================
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	defaultKeyRotation = 30 * 24 * time.Hour
+	// keyActivationDelay is how long a new key is published in the JWKS
+	// before it signs anything, so that instances and downstream caches
+	// (max-age 5 minutes) know it by the time they see it.
+	keyActivationDelay = 10 * time.Minute
+	// keyReloadInterval limits how often an unknown kid triggers a reload,
+	// so forged kids cannot hammer the key store.
+	keyReloadInterval = 30 * time.Second
+	rsaKeyBits        = 2048
+)
+
+// KeyStore persists signing keys so that every instance signs and verifies
+// with the same set.
+type KeyStore interface {
+	LoadKeys(ctx context.Context) ([]models.SigningKey, error)
+	// SaveKey stores key, replacing a stored key with the same ID.
+	SaveKey(ctx context.Context, key models.SigningKey) error
+	DeleteKey(ctx context.Context, keyID string) error
+}
+
+// KeyringConfig controls the algorithm and rotation schedule.
+type KeyringConfig struct {
+	Algorithm string
+	// RotationPeriod is how long a key signs new tokens before a fresh one
+	// replaces it.
+	RotationPeriod time.Duration
+	// Retention is how long a replaced key still verifies tokens. It must
+	// outlive the longest token it may have signed.
+	Retention time.Duration
+	// EncryptionKey is the 32-byte AES key that seals private keys before
+	// they are stored. Without it they are stored in plain text.
+	EncryptionKey []byte
+}
+
+// KeyringConfigFromEnv reads JWT_SIGNING_ALG (RS256 or EdDSA, default RS256),
+// JWT_KEY_ROTATION_PERIOD (default 720h) and JWT_KEY_ENCRYPTION_KEY, a
+// base64-encoded 32-byte key. Storing private keys in plain text instead
+// must be asked for with JWT_KEY_ALLOW_PLAINTEXT=true.
+func KeyringConfigFromEnv() (KeyringConfig, error) {
+	cfg := KeyringConfig{
+		Algorithm:      AlgRS256,
+		RotationPeriod: defaultKeyRotation,
+		Retention:      RefreshTokenTTL + time.Hour,
+	}
+	if v := os.Getenv("JWT_SIGNING_ALG"); v != "" {
+		if v != AlgRS256 && v != AlgEdDSA {
+			return cfg, fmt.Errorf("JWT_SIGNING_ALG must be %s or %s", AlgRS256, AlgEdDSA)
+		}
+		cfg.Algorithm = v
+	}
+	if v := os.Getenv("JWT_KEY_ROTATION_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid JWT_KEY_ROTATION_PERIOD %q", v)
+		}
+		cfg.RotationPeriod = d
+	}
+	if v := os.Getenv("JWT_KEY_ENCRYPTION_KEY"); v != "" {
+		kek, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(kek) != 32 {
+			return cfg, errors.New("JWT_KEY_ENCRYPTION_KEY must be 32 bytes, base64-encoded")
+		}
+		cfg.EncryptionKey = kek
+	} else if os.Getenv("JWT_KEY_ALLOW_PLAINTEXT") != "true" {
+		return cfg, errors.New("JWT_KEY_ENCRYPTION_KEY is required to encrypt signing keys at rest (set JWT_KEY_ALLOW_PLAINTEXT=true to store them unencrypted)")
+	}
+	return cfg, nil
+}
+
+// signingKey is a parsed models.SigningKey.
+type signingKey struct {
+	models.SigningKey
+	private crypto.Signer
+	method  jwt.SigningMethod
+}
+
+// Keyring holds the signing keys. The newest key past its activation delay
+// signs; every key that has not passed its retention verifies.
+type Keyring struct {
+	store KeyStore
+	cfg   KeyringConfig
+
+	mu         sync.RWMutex
+	keys       map[string]*signingKey
+	lastReload time.Time
+}
+
+// NewKeyring returns an empty keyring; call Load before using it.
+func NewKeyring(store KeyStore, cfg KeyringConfig) *Keyring {
+	return &Keyring{store: store, cfg: cfg, keys: map[string]*signingKey{}}
+}
+
+// Load reads the keys from the store and creates the first key, or a new
+// one when the current key is due for rotation.
+func (k *Keyring) Load(ctx context.Context) error {
+	if err := k.reload(ctx); err != nil {
+		return err
+	}
+	return k.rotateIfDue(ctx)
+}
+
+func (k *Keyring) reload(ctx context.Context) error {
+	stored, err := k.store.LoadKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(stored))
+	for _, s := range stored {
+		key, err := parseSigningKey(s, k.cfg.EncryptionKey)
+		if err != nil && sealed(s.PrivateKey) {
+			// A wrong encryption key must not quietly rotate to keys the
+			// other instances cannot read
+			return fmt.Errorf("signing key %s: %w", s.KeyID, err)
+		}
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", s.KeyID, err)
+			continue
+		}
+		keys[key.KeyID] = key
+
+		// Keys stored before encryption was configured are sealed now
+		if k.cfg.EncryptionKey != nil && !sealed(s.PrivateKey) {
+			if err := k.save(ctx, s); err != nil {
+				return err
+			}
+			log.Printf("Encrypted signing key %s at rest", s.KeyID)
+		}
+	}
+
+	k.mu.Lock()
+	k.keys, k.lastReload = keys, time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// sortedKeys returns the keys, oldest first.
+func (k *Keyring) sortedKeys() []*signingKey {
+	k.mu.RLock()
+	keys := make([]*signingKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	k.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// activeKey returns the key that signs new tokens: the newest one past its
+// activation delay, or the oldest key while none is (on first start).
+func (k *Keyring) activeKey() *signingKey {
+	keys := k.sortedKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if time.Since(keys[i].CreatedAt) >= keyActivationDelay {
+			return keys[i]
+		}
+	}
+	return keys[0]
+}
+
+// rotateIfDue creates a new key once the newest one is older than the
+// rotation period, or uses a different algorithm than configured.
+func (k *Keyring) rotateIfDue(ctx context.Context) error {
+	keys := k.sortedKeys()
+	if len(keys) > 0 {
+		newest := keys[len(keys)-1]
+		if newest.Algorithm == k.cfg.Algorithm && time.Since(newest.CreatedAt) < k.cfg.RotationPeriod {
+			return k.prune(ctx)
+		}
+	}
+	return k.Rotate(ctx)
+}
+
+// Rotate creates a new signing key, which starts signing after the
+// activation delay. Older keys keep verifying until their retention ends. If
+// two instances rotate at the same time both keys stay valid, so the race is
+// harmless.
+func (k *Keyring) Rotate(ctx context.Context) error {
+	stored, err := generateSigningKey(k.cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+	key, err := parseSigningKey(stored, nil)
+	if err != nil {
+		return err
+	}
+	if err := k.save(ctx, stored); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys[key.KeyID] = key
+	k.mu.Unlock()
+
+	log.Printf("Rotated JWT signing key, new kid %s (%s)", key.KeyID, key.Algorithm)
+	return k.prune(ctx)
+}
+
+// save stores key, sealing its private key first when encryption is on.
+func (k *Keyring) save(ctx context.Context, key models.SigningKey) error {
+	if k.cfg.EncryptionKey != nil {
+		sealedKey, err := sealPrivateKey(k.cfg.EncryptionKey, key.KeyID, key.PrivateKey)
+		if err != nil {
+			return err
+		}
+		key.PrivateKey = sealedKey
+	}
+	return k.store.SaveKey(ctx, key)
+}
+
+// prune deletes keys that were replaced longer than the retention ago.
+func (k *Keyring) prune(ctx context.Context) error {
+	keys := k.sortedKeys()
+	for i := 0; i < len(keys)-1; i++ {
+		replacedAt := keys[i+1].CreatedAt.Add(keyActivationDelay)
+		if time.Since(replacedAt) < k.cfg.Retention {
+			continue
+		}
+		if err := k.store.DeleteKey(ctx, keys[i].KeyID); err != nil {
+			return err
+		}
+		k.mu.Lock()
+		delete(k.keys, keys[i].KeyID)
+		k.mu.Unlock()
+	}
+	return nil
+}
+
+// RunRotation reloads the keys every minute, picking up keys rotated by other
+// instances, and rotates when the current key is due. It returns when ctx is
+// done.
+func (k *Keyring) RunRotation(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Load(ctx); err != nil {
+				log.Printf("JWT key rotation failed: %v", err)
+			}
+		}
+	}
+}
+
+// sign signs claims with the current key and sets the kid header.
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	key := k.activeKey()
+	if key == nil {
+		return "", errors.New("no signing key loaded")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.KeyID
+	return token.SignedString(key.private)
+}
+
+// verificationKey is a jwt.Keyfunc that picks the key named by the kid
+// header, reloading the store once if the kid is unknown.
+func (k *Keyring) verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	key := k.lookup(kid)
+	if key == nil {
+		k.mu.RLock()
+		stale := time.Since(k.lastReload) > keyReloadInterval
+		k.mu.RUnlock()
+		if stale {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := k.reload(ctx); err != nil {
+				return nil, err
+			}
+			key = k.lookup(kid)
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("token algorithm does not match its key")
+	}
+	return key.private.Public(), nil
+}
+
+func (k *Keyring) lookup(kid string) *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[kid]
+}
+
+// ================= JWKS =================
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every key that can verify tokens,
+// including a new key that does not sign yet.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	b64 := base64.RawURLEncoding
+	for _, key := range k.sortedKeys() {
+		jwk := JWK{Use: "sig", KeyID: key.KeyID, Algorithm: key.Algorithm}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = b64.EncodeToString(pub.N.Bytes())
+			jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = b64.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// ================= KEY ENCODING =================
+
+func generateSigningKey(alg string) (models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	return models.SigningKey{
+		KeyID:      GenerateID(),
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// parseSigningKey decodes a stored key, opening it with kek when it is
+// sealed.
+func parseSigningKey(s models.SigningKey, kek []byte) (*signingKey, error) {
+	text := s.PrivateKey
+	if sealed(text) {
+		if kek == nil {
+			return nil, errors.New("key is encrypted but JWT_KEY_ENCRYPTION_KEY is not set")
+		}
+		opened, err := openPrivateKey(kek, s.KeyID, text)
+		if err != nil {
+			return nil, err
+		}
+		text = opened
+	}
+
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{SigningKey: s}
+	switch p := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.private, key.method = p, jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		key.private, key.method = p, jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	if key.method.Alg() != s.Algorithm {
+		return nil, fmt.Errorf("key type does not match algorithm %s", s.Algorithm)
+	}
+	return key, nil
+}
+
+// ================= KEY ENCRYPTION =================
+
+// sealedKeyPrefix marks a private key sealed with AES-256-GCM; the rest is
+// the base64 of the nonce followed by the ciphertext.
+const sealedKeyPrefix = "aes256gcm:"
+
+func sealed(privateKey string) bool {
+	return strings.HasPrefix(privateKey, sealedKeyPrefix)
+}
+
+// sealPrivateKey encrypts a PEM private key with kek. The key ID is bound as
+// additional data, so a sealed key cannot be swapped onto another ID.
+func sealPrivateKey(kek []byte, keyID, pemText string) (string, error) {
+	gcm, err := newKeyCipher(kek)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := gcm.Seal(nonce, nonce, []byte(pemText), []byte(keyID))
+	return sealedKeyPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+func openPrivateKey(kek []byte, keyID, sealedKey string) (string, error) {
+	gcm, err := newKeyCipher(kek)
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealedKey, sealedKeyPrefix))
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted key")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], []byte(keyID))
+	if err != nil {
+		return "", errors.New("cannot decrypt key, check JWT_KEY_ENCRYPTION_KEY")
+	}
+	return string(plain), nil
+}
+
+func newKeyCipher(kek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ================= LEXICON CLASSIFIER =================
+
+// LexiconClassifier scores a review with a built-in word list and needs no
+// model or network. Labels must be ordered from best to worst; the score is
+// spread evenly over them.
+type LexiconClassifier struct{}
+
+func (LexiconClassifier) Name() string { return "lexicon" }
+
+func (LexiconClassifier) Classify(ctx context.Context, review string, labels []string) (string, error) {
+	if len(labels) == 0 {
+		return "", errors.New("no labels to choose from")
+	}
+	score := SentimentScore(review)
+	// Map [1, -1] onto [0, len(labels))
+	idx := int((1 - score) / 2 * float64(len(labels)))
+	if idx >= len(labels) {
+		idx = len(labels) - 1
+	}
+	return labels[idx], nil
+}
+
+// Words that turn a following sentiment word around, within negationWindow
+// words of the same clause.
+var negators = map[string]bool{
+	"not": true, "no": true, "never": true, "nothing": true, "nobody": true,
+	"neither": true, "nor": true, "none": true, "without": true, "hardly": true,
+	"barely": true, "cannot": true, "isnt": true, "wasnt": true, "arent": true,
+	"werent": true, "dont": true, "doesnt": true, "didnt": true, "cant": true,
+	"couldnt": true, "wont": true, "wouldnt": true, "shouldnt": true, "aint": true,
+}
+
+const (
+	negationWindow = 3
+	negationFactor = -0.75
+	maxSentiment   = 4
+	clauseBreak    = "."
+)
+
+// Words after which the rest of the review matters more.
+var contrasts = map[string]bool{
+	"but": true, "however": true, "although": true, "though": true, "yet": true,
+}
+
+// Words that scale the sentiment word right after them.
+var intensifiers = map[string]float64{
+	"very": 1.5, "really": 1.4, "so": 1.3, "extremely": 1.8, "incredibly": 1.8,
+	"absolutely": 1.8, "truly": 1.4, "totally": 1.5, "utterly": 1.8, "highly": 1.5,
+	"super": 1.5, "most": 1.4, "too": 1.3, "thoroughly": 1.5, "quite": 1.2,
+	"pretty": 1.1, "somewhat": 0.6, "slightly": 0.5, "kinda": 0.6, "fairly": 0.8,
+	"mildly": 0.5, "bit": 0.6, "little": 0.6, "rather": 0.8,
+}
+
+// Sentiment words and their strength, from -4 to 4.
+var sentimentWords = map[string]float64{
+	// Positive
+	"masterpiece": 4, "masterful": 4, "brilliant": 3.5, "outstanding": 3.5,
+	"excellent": 3.5, "superb": 3.5, "phenomenal": 3.5, "perfect": 3.5,
+	"flawless": 3.5, "stunning": 3, "amazing": 3, "incredible": 3,
+	"fantastic": 3, "wonderful": 3, "magnificent": 3.5, "exceptional": 3.5,
+	"breathtaking": 3, "gripping": 2.5, "captivating": 2.5, "riveting": 2.5,
+	"moving": 2, "beautiful": 2.5, "beautifully": 2.5, "love": 3, "loved": 3,
+	"loves": 3, "lovely": 2.5, "great": 2.5, "awesome": 3, "terrific": 3,
+	"compelling": 2, "delightful": 2.5, "engaging": 2, "enjoyable": 2,
+	"enjoyed": 2, "enjoy": 2, "fun": 1.5, "funny": 1.5, "hilarious": 2.5,
+	"charming": 2, "clever": 2, "smart": 1.5, "impressive": 2.5, "memorable": 2,
+	"powerful": 2, "satisfying": 2, "solid": 1.5, "strong": 1.5, "good": 1.8,
+	"nice": 1.5, "fine": 0.8, "decent": 1, "pleasant": 1.5, "entertaining": 2,
+	"recommend": 2, "recommended": 2, "worth": 1.5, "best": 3, "better": 1.5,
+	"like": 1, "liked": 1.5, "touching": 2, "thrilling": 2.5, "exciting": 2,
+	"fresh": 1.5, "original": 1.5, "polished": 1.5, "favourite": 2.5,
+	"favorite": 2.5, "classic": 2, "well": 0.8, "ok": 0.3, "okay": 0.3,
+	"watchable": 0.5, "passable": 0.3, "adequate": 0.3, "competent": 0.8,
+	// Negative
+	"terrible": -3.5, "awful": -3.5, "horrible": -3.5, "atrocious": -4,
+	"abysmal": -4, "dreadful": -3.5, "worst": -4, "garbage": -3.5,
+	"trash": -3.5, "disaster": -3.5, "unwatchable": -4, "painful": -2.5,
+	"hate": -3, "hated": -3, "hates": -3, "bad": -2.5, "poor": -2.5,
+	"poorly": -2.5, "weak": -2, "boring": -2.5, "bored": -2, "dull": -2,
+	"tedious": -2.5, "bland": -1.5, "mediocre": -1.5, "forgettable": -1.5,
+	"disappointing": -2.5, "disappointed": -2.5, "disappointment": -2.5,
+	"mess": -2.5, "messy": -2, "predictable": -1.5, "clichéd": -1.5,
+	"cliched": -1.5, "cheesy": -1, "stupid": -2.5, "silly": -1, "annoying": -2,
+	"waste": -3, "wasted": -3, "pointless": -2.5, "confusing": -1.5,
+	"slow": -1, "overlong": -1.5, "overrated": -2, "lame": -2, "meh": -1,
+	"flat": -1.5, "lifeless": -2.5, "wooden": -2, "ugly": -2, "worse": -2,
+	"fails": -2, "failed": -2, "failure": -2.5, "flawed": -1.5,
+	"unfunny": -2, "nonsense": -2, "incoherent": -2.5, "clumsy": -1.5,
+	"avoid": -2, "regret": -2, "sucks": -3, "sucked": -3, "crap": -3,
+	"cringe": -2, "cringeworthy": -2.5, "lazy": -2, "shallow": -1.5,
+}
+
+// SentimentScore returns how positive review is, from -1 (very negative) to
+// 1 (very positive): the average strength of its sentiment words. Negations
+// within a few words flip and dampen a word, intensifiers scale it, and words
+// after "but" or "however" weigh more than those before.
+func SentimentScore(review string) float64 {
+	words := sentimentTokens(review)
+
+	var sum, weights float64
+	weight := 1.0
+	for i, w := range words {
+		if contrasts[w] {
+			// What came before counts half as much as what follows
+			sum *= 0.5
+			weights *= 0.5
+			weight = 1.5
+			continue
+		}
+		value, ok := sentimentWords[w]
+		if !ok {
+			continue
+		}
+		if i > 0 {
+			if factor, ok := intensifiers[words[i-1]]; ok {
+				value *= factor
+			}
+		}
+		for j := i - 1; j >= 0 && j >= i-negationWindow && words[j] != clauseBreak; j-- {
+			if negators[words[j]] {
+				value *= negationFactor
+				break
+			}
+		}
+		sum += weight * value
+		weights += weight
+	}
+	if weights == 0 {
+		return 0
+	}
+
+	score := sum / weights
+	// Each exclamation mark adds emphasis, up to three
+	bangs := math.Min(float64(strings.Count(review, "!")), 3)
+	if score < 0 {
+		score -= bangs * 0.3
+	} else if score > 0 {
+		score += bangs * 0.3
+	}
+	return math.Max(-1, math.Min(1, score/maxSentiment))
+}
+
+// sentimentTokens lowercases review and splits it into words, dropping
+// apostrophes so that "didn't" and "didnt" match the same entry. Punctuation
+// that ends a clause becomes a clauseBreak token.
+func sentimentTokens(review string) []string {
+	review = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(review))
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range review {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		case strings.ContainsRune(".,;:!?", r):
+			flush()
+			tokens = append(tokens, clauseBreak)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
@@ -0,0 +1,470 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ================= OIDC PROVIDERS =================
+
+// OIDCProviderConfig describes an external identity provider. Providers
+// with an issuer fill in missing endpoints from the issuer's discovery
+// document; plain OAuth2 providers without ID tokens, such as GitHub, set
+// the endpoints and a userinfo URL instead.
+type OIDCProviderConfig struct {
+	Name             string   `json:"name"`
+	DisplayName      string   `json:"display_name"`
+	Issuer           string   `json:"issuer"`
+	ClientID         string   `json:"client_id"`
+	ClientSecret     string   `json:"client_secret"`
+	AuthorizationURL string   `json:"authorization_url"`
+	TokenURL         string   `json:"token_url"`
+	UserInfoURL      string   `json:"userinfo_url"`
+	JWKSURL          string   `json:"jwks_url"`
+	RedirectURL      string   `json:"redirect_url"`
+	Scopes           []string `json:"scopes"`
+	// SubjectClaim names the claim holding the stable user ID (default
+	// "sub"; GitHub uses "id").
+	SubjectClaim string `json:"subject_claim"`
+	// TrustEmail treats the email as verified when the provider sends no
+	// email_verified claim. Only set it for providers that verify emails.
+	TrustEmail bool `json:"trust_email"`
+}
+
+// OIDCIdentity is what a provider asserted about the user who signed in.
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+}
+
+const (
+	oidcHTTPTimeout     = 10 * time.Second
+	oidcJWKSMinRefresh  = time.Minute
+	oidcClockSkew       = time.Minute
+	oidcMaxResponseSize = 1 << 20
+)
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// OIDCProvider runs the relying-party side of the authorization code flow
+// against one provider.
+type OIDCProvider struct {
+	cfg    OIDCProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovered  bool
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// NewOIDCProvider validates cfg and returns its provider.
+func NewOIDCProvider(cfg OIDCProviderConfig) (*OIDCProvider, error) {
+	cfg.Name = strings.ToLower(strings.TrimSpace(cfg.Name))
+	if !providerNamePattern.MatchString(cfg.Name) {
+		return nil, fmt.Errorf("invalid provider name %q", cfg.Name)
+	}
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("provider %q has no client_id", cfg.Name)
+	}
+	if cfg.Issuer == "" && (cfg.AuthorizationURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "") {
+		return nil, fmt.Errorf("provider %q needs an issuer, or authorization, token and userinfo URLs", cfg.Name)
+	}
+	if cfg.RedirectURL == "" {
+		base := os.Getenv("APP_BASE_URL")
+		if base == "" {
+			base = "http://localhost:5173"
+		}
+		cfg.RedirectURL = strings.TrimRight(base, "/") + "/auth/callback/" + cfg.Name
+	}
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.SubjectClaim == "" {
+		cfg.SubjectClaim = "sub"
+	}
+	return &OIDCProvider{cfg: cfg, client: &http.Client{Timeout: oidcHTTPTimeout}}, nil
+}
+
+func (p *OIDCProvider) Name() string        { return p.cfg.Name }
+func (p *OIDCProvider) DisplayName() string { return p.cfg.DisplayName }
+
+// OIDCProviders holds the configured providers by name.
+type OIDCProviders map[string]*OIDCProvider
+
+// Get returns the named provider, or nil.
+func (ps OIDCProviders) Get(name string) *OIDCProvider {
+	return ps[strings.ToLower(name)]
+}
+
+// Sorted returns the providers ordered by name.
+func (ps OIDCProviders) Sorted() []*OIDCProvider {
+	out := make([]*OIDCProvider, 0, len(ps))
+	for _, p := range ps {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].cfg.Name < out[j].cfg.Name })
+	return out
+}
+
+// LoadOIDCProviders reads a JSON array of OIDCProviderConfig. Environment
+// variables in the file are expanded, so client secrets can stay out of it.
+func LoadOIDCProviders(path string) (OIDCProviders, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []OIDCProviderConfig
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(raw))), &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	providers := OIDCProviders{}
+	for _, cfg := range configs {
+		p, err := NewOIDCProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := providers[p.Name()]; ok {
+			return nil, fmt.Errorf("provider %q is defined twice", p.Name())
+		}
+		providers[p.Name()] = p
+	}
+	log.Printf("Loaded %d identity providers from %s", len(providers), path)
+	return providers, nil
+}
+
+// ================= PKCE =================
+
+// GeneratePKCE returns a code verifier and its S256 challenge (RFC 7636).
+func GeneratePKCE() (verifier, challenge string, err error) {
+	verifier, _, err = GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// ================= AUTHORIZATION CODE FLOW =================
+
+// discover fills in the endpoints missing from the config from the
+// issuer's /.well-known/openid-configuration, once.
+func (p *OIDCProvider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered || p.cfg.Issuer == "" {
+		return nil
+	}
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	wellKnown := strings.TrimRight(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, "", &doc); err != nil {
+		return fmt.Errorf("discovery: %w", err)
+	}
+	if doc.Issuer != p.cfg.Issuer {
+		return fmt.Errorf("discovery: issuer %q does not match %q", doc.Issuer, p.cfg.Issuer)
+	}
+	fill := func(dst *string, v string) {
+		if *dst == "" {
+			*dst = v
+		}
+	}
+	fill(&p.cfg.AuthorizationURL, doc.AuthorizationEndpoint)
+	fill(&p.cfg.TokenURL, doc.TokenEndpoint)
+	fill(&p.cfg.UserInfoURL, doc.UserInfoEndpoint)
+	fill(&p.cfg.JWKSURL, doc.JWKSURI)
+	if p.cfg.AuthorizationURL == "" || p.cfg.TokenURL == "" {
+		return errors.New("discovery: document has no authorization or token endpoint")
+	}
+	p.discovered = true
+	return nil
+}
+
+// AuthCodeURL returns the provider URL to send the user to.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.cfg.AuthorizationURL, "?") {
+		sep = "&"
+	}
+	return p.cfg.AuthorizationURL + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the signed-in user.
+// The ID token, when the provider sends one, must be signed by the provider
+// and carry the nonce of the flow; claims missing from it are read from the
+// userinfo endpoint.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (OIDCIdentity, error) {
+	if err := p.discover(ctx); err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := p.doJSON(req, &tokens); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("token exchange: %w", err)
+	}
+	if tokens.Error != "" {
+		return OIDCIdentity{}, fmt.Errorf("token exchange: %s", tokens.Error)
+	}
+
+	claims := map[string]interface{}{}
+	if tokens.IDToken != "" {
+		if claims, err = p.verifyIDToken(ctx, tokens.IDToken, nonce); err != nil {
+			return OIDCIdentity{}, err
+		}
+	} else if p.cfg.UserInfoURL == "" {
+		return OIDCIdentity{}, errors.New("provider returned no ID token and has no userinfo endpoint")
+	}
+
+	if p.cfg.UserInfoURL != "" && tokens.AccessToken != "" && (tokens.IDToken == "" || claims["email"] == nil) {
+		info := map[string]interface{}{}
+		if err := p.getJSON(ctx, p.cfg.UserInfoURL, tokens.AccessToken, &info); err != nil {
+			return OIDCIdentity{}, fmt.Errorf("userinfo: %w", err)
+		}
+		// The userinfo subject must be the ID token's, if there was one
+		if sub, ok := claims[p.cfg.SubjectClaim]; ok && claimString(info[p.cfg.SubjectClaim]) != claimString(sub) {
+			return OIDCIdentity{}, errors.New("userinfo: subject does not match the ID token")
+		}
+		for k, v := range info {
+			if _, ok := claims[k]; !ok {
+				claims[k] = v
+			}
+		}
+	}
+
+	id := OIDCIdentity{
+		Subject:    claimString(claims[p.cfg.SubjectClaim]),
+		Email:      strings.ToLower(strings.TrimSpace(claimString(claims["email"]))),
+		GivenName:  claimString(claims["given_name"]),
+		FamilyName: claimString(claims["family_name"]),
+		Name:       claimString(claims["name"]),
+	}
+	if id.Subject == "" {
+		return OIDCIdentity{}, fmt.Errorf("provider returned no %q claim", p.cfg.SubjectClaim)
+	}
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	default:
+		id.EmailVerified = p.cfg.TrustEmail
+	}
+	return id, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw, nonce string) (map[string]interface{}, error) {
+	if p.cfg.Issuer == "" || p.cfg.JWKSURL == "" {
+		return nil, errors.New("provider sent an ID token but has no issuer or JWKS URL to verify it")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.verificationKey(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(oidcClockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("id token: %w", err)
+	}
+	if claimString(claims["nonce"]) != nonce {
+		return nil, errors.New("id token: nonce does not match")
+	}
+	return claims, nil
+}
+
+// verificationKey returns the provider key named kid, refetching the JWKS
+// when the kid is unknown, at most once a minute.
+func (p *OIDCProvider) verificationKey(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < oidcJWKSMinRefresh {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.cfg.JWKSURL, "", &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	p.keysFetched = time.Now()
+
+	keys := map[string]interface{}{}
+	b64 := base64.RawURLEncoding
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.KeyType {
+		case "RSA":
+			n, errN := b64.DecodeString(k.N)
+			e, errE := b64.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+			keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Curve {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, errX := b64.DecodeString(k.X)
+			y, errY := b64.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.KeyID] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		case "OKP":
+			x, err := b64.DecodeString(k.X)
+			if err != nil || k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+			keys[k.KeyID] = ed25519.PublicKey(x)
+		}
+	}
+	p.keys = keys
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown kid %q", kid)
+}
+
+// ================= HTTP HELPERS =================
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint, bearer string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return p.doJSON(req, out)
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Redacted(), resp.Status)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// claimString renders a string or numeric claim, such as GitHub's numeric
+// user ID, as a string.
+func claimString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
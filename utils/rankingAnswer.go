@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ================= RANKING ANSWERS =================
+
+// ErrUnrecognizedRanking is returned when a classifier's answer does not name
+// exactly one of the rankings.
+var ErrUnrecognizedRanking = errors.New("classifier answer does not match any ranking")
+
+// Keys under which models tend to put the answer when they stray from the
+// schema.
+var answerKeys = []string{"ranking", "sentiment", "label", "rank", "rating", "classification", "answer"}
+
+// MatchRanking finds the label that answer names. It accepts a JSON object
+// such as {"ranking": "Good"}, possibly wrapped in a code fence or prose,
+// as well as a bare label. Labels are compared ignoring case, punctuation and
+// underscores; failing that, a label mentioned on its own in the answer or a
+// close misspelling of exactly one label is accepted.
+func MatchRanking(answer string, labels []string) (string, error) {
+	text := answer
+	if value, ok := answerFromJSON(answer); ok {
+		text = value
+	}
+	text = Normalize(text)
+	if text == "" {
+		return "", fmt.Errorf("%w: empty answer", ErrUnrecognizedRanking)
+	}
+
+	normalized := make([]string, len(labels))
+	for i, l := range labels {
+		normalized[i] = Normalize(l)
+		if normalized[i] == text {
+			return l, nil
+		}
+	}
+
+	// "The sentiment is Good." names one label among other words
+	found := -1
+	for i, l := range normalized {
+		if l != "" && mentions(text, l) {
+			if found >= 0 && normalized[found] != l {
+				return "", fmt.Errorf("%w: %q names more than one ranking", ErrUnrecognizedRanking, answer)
+			}
+			found = i
+		}
+	}
+	if found >= 0 {
+		return labels[found], nil
+	}
+
+	// Misspellings such as "Excelent", allowing one edit per four letters
+	best, bestDistance, tie := -1, 0, false
+	for i, l := range normalized {
+		d := Levenshtein(text, l)
+		if d > len([]rune(l))/4 {
+			continue
+		}
+		switch {
+		case best < 0 || d < bestDistance:
+			best, bestDistance, tie = i, d, false
+		case d == bestDistance:
+			tie = true
+		}
+	}
+	if best >= 0 && !tie {
+		return labels[best], nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnrecognizedRanking, truncate(answer, 200))
+}
+
+// mentions reports whether label occurs in text as whole words and is not
+// negated, as in "not good".
+func mentions(text, label string) bool {
+	words := strings.Fields(text)
+	want := strings.Fields(label)
+	for i := 0; i+len(want) <= len(words); i++ {
+		if strings.Join(words[i:i+len(want)], " ") != label {
+			continue
+		}
+		if i == 0 || !negators[words[i-1]] {
+			return true
+		}
+	}
+	return false
+}
+
+// answerFromJSON extracts the ranking from the first JSON object in answer.
+func answerFromJSON(answer string) (string, bool) {
+	start := strings.Index(answer, "{")
+	end := strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return "", false
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &obj); err != nil {
+		return "", false
+	}
+	lower := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		lower[strings.ToLower(k)] = v
+	}
+	for _, key := range answerKeys {
+		if s, ok := lower[key].(string); ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// truncate shortens s to at most n runes for error messages.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
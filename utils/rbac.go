@@ -0,0 +1,331 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samrato/magicstream/models"
+)
+
+// ================= PERMISSIONS =================
+const (
+	PermMoviesWrite   = "movies:write"    // edit, delete, restore, purge and import movies
+	PermReviewsWrite  = "reviews:write"   // write admin reviews and rankings
+	PermCatalogExport = "catalog:export"  // export the catalog collections
+	PermUsersRead     = "users:read"      // list users and read their details and audit log
+	PermUsersSessions = "users:sessions"  // log users out of every device
+	PermUsersManage   = "users:manage"    // change roles, disable and enable accounts
+	PermRolesManage   = "roles:manage"    // create, change and delete roles
+	PermAPIKeysManage = "api_keys:manage" // create, list and revoke API keys
+)
+
+// Permissions lists every permission a role can be granted.
+var Permissions = []string{
+	PermMoviesWrite,
+	PermReviewsWrite,
+	PermCatalogExport,
+	PermUsersRead,
+	PermUsersSessions,
+	PermUsersManage,
+	PermRolesManage,
+	PermAPIKeysManage,
+}
+
+// Built-in roles. AdminRole always holds every permission, whatever the
+// store says, so that a bad edit cannot lock every admin out.
+const (
+	AdminRole   = "ADMIN"
+	DefaultRole = "USER"
+)
+
+// DefaultRoles seeds an empty role store.
+var DefaultRoles = []models.Role{
+	{Name: DefaultRole, Description: "Regular user", Permissions: []string{}},
+	{Name: "EDITOR", Description: "Maintains the movie catalog", Permissions: []string{PermMoviesWrite, PermCatalogExport}},
+	{Name: "MODERATOR", Description: "Writes reviews and rankings", Permissions: []string{PermReviewsWrite}},
+	{Name: "SUPPORT", Description: "Helps users with their accounts", Permissions: []string{PermUsersRead, PermUsersSessions}},
+	{Name: AdminRole, Description: "Full access", Permissions: []string{"*"}},
+}
+
+const roleReloadInterval = time.Minute
+
+var roleNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{1,31}$`)
+
+// RoleStore persists the role definitions so that every instance applies the
+// same permissions.
+type RoleStore interface {
+	LoadRoles(ctx context.Context) ([]models.Role, error)
+	SaveRole(ctx context.Context, role models.Role) error
+	DeleteRole(ctx context.Context, name string) error
+}
+
+// ValidateRole normalises the role name to upper case and checks the name
+// and permissions.
+func ValidateRole(role *models.Role) error {
+	role.Name = strings.ToUpper(strings.TrimSpace(role.Name))
+	if !roleNamePattern.MatchString(role.Name) {
+		return errors.New("role name must be 2-32 letters, digits or underscores, starting with a letter")
+	}
+
+	perms, err := NormalizePermissions(role.Permissions)
+	if err != nil {
+		return err
+	}
+	role.Permissions = perms
+	return nil
+}
+
+// NormalizePermissions lower-cases, de-duplicates and sorts permissions,
+// rejecting unknown ones. API key scopes use the same rules.
+func NormalizePermissions(list []string) ([]string, error) {
+	seen := map[string]bool{}
+	perms := []string{}
+	for _, p := range list {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if !knownPermission(p) {
+			return nil, fmt.Errorf("unknown permission %q", p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+	sort.Strings(perms)
+	return perms, nil
+}
+
+// ScopesGrant reports whether any of the scopes covers perm.
+func ScopesGrant(scopes []string, perm string) bool {
+	for _, granted := range scopes {
+		if grants(granted, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownPermission accepts a permission from Permissions, "*", or a prefix
+// wildcard such as "movies:*" that matches at least one of them.
+func knownPermission(p string) bool {
+	if p == "*" {
+		return true
+	}
+	for _, known := range Permissions {
+		if p == known || grants(p, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// grants reports whether the granted permission covers perm.
+func grants(granted, perm string) bool {
+	if granted == "*" || granted == perm {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(granted, "*")
+	return ok && strings.HasSuffix(prefix, ":") && strings.HasPrefix(perm, prefix)
+}
+
+// ================= POLICY =================
+
+// Policy maps roles to permissions. It caches the role store and reloads it
+// periodically, so a role edited on one instance applies everywhere within
+// a minute.
+type Policy struct {
+	store       RoleStore
+	defaultRole string
+	mfaRoles    map[string]bool
+
+	mu    sync.RWMutex
+	roles map[string]models.Role
+}
+
+// NewPolicy returns an empty policy; call Load before using it.
+func NewPolicy(store RoleStore) *Policy {
+	return &Policy{store: store, defaultRole: DefaultRole, mfaRoles: map[string]bool{}, roles: map[string]models.Role{}}
+}
+
+// Load reads the roles from the store, seeding it with DefaultRoles when it
+// is empty.
+func (p *Policy) Load(ctx context.Context) error {
+	roles, err := p.store.LoadRoles(ctx)
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		now := time.Now()
+		for _, role := range DefaultRoles {
+			role.UpdatedAt = now
+			if err := p.store.SaveRole(ctx, role); err != nil {
+				return err
+			}
+			roles = append(roles, role)
+		}
+		log.Printf("Seeded %d default roles", len(roles))
+	}
+
+	loaded := make(map[string]models.Role, len(roles))
+	for _, role := range roles {
+		loaded[role.Name] = role
+	}
+	p.mu.Lock()
+	p.roles = loaded
+	p.mu.Unlock()
+	return nil
+}
+
+// ApplyRolesFile saves the roles defined in a JSON file, an array of
+// {"name", "description", "permissions"} objects, overwriting stored roles
+// of the same name.
+func (p *Policy) ApplyRolesFile(ctx context.Context, path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var roles []models.Role
+	if err := json.Unmarshal(raw, &roles); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, role := range roles {
+		if err := p.Save(ctx, role); err != nil {
+			return fmt.Errorf("role %q in %s: %w", role.Name, path, err)
+		}
+	}
+	log.Printf("Applied %d roles from %s", len(roles), path)
+	return nil
+}
+
+// Save validates and stores a role, replacing any role of the same name.
+func (p *Policy) Save(ctx context.Context, role models.Role) error {
+	if err := ValidateRole(&role); err != nil {
+		return err
+	}
+	role.UpdatedAt = time.Now()
+	if err := p.store.SaveRole(ctx, role); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.roles[role.Name] = role
+	p.mu.Unlock()
+	return nil
+}
+
+// Delete removes a role from the store.
+func (p *Policy) Delete(ctx context.Context, name string) error {
+	if err := p.store.DeleteRole(ctx, name); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	delete(p.roles, name)
+	p.mu.Unlock()
+	return nil
+}
+
+// RunReload reloads the roles every minute until ctx is done.
+func (p *Policy) RunReload(ctx context.Context) {
+	ticker := time.NewTicker(roleReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Load(ctx); err != nil {
+				log.Printf("Failed to reload roles: %v", err)
+			}
+		}
+	}
+}
+
+// UseDefaultRole sets the role given to newly registered users. The role
+// must be defined.
+func (p *Policy) UseDefaultRole(name string) error {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if _, ok := p.Role(name); !ok {
+		return fmt.Errorf("role %q is not defined", name)
+	}
+	p.defaultRole = name
+	return nil
+}
+
+// DefaultRole returns the role given to newly registered users.
+func (p *Policy) DefaultRole() string {
+	return p.defaultRole
+}
+
+// RequireMFA makes the roles unable to use their permissions until they log
+// in with a second factor. Call it at startup only.
+func (p *Policy) RequireMFA(roles ...string) {
+	for _, role := range roles {
+		if role = strings.ToUpper(strings.TrimSpace(role)); role != "" {
+			p.mfaRoles[role] = true
+		}
+	}
+}
+
+// MFARequired reports whether the role must use two-factor authentication.
+func (p *Policy) MFARequired(role string) bool {
+	return p.mfaRoles[role]
+}
+
+// Allows reports whether the role grants perm.
+func (p *Policy) Allows(role, perm string) bool {
+	if role == AdminRole {
+		return true
+	}
+	p.mu.RLock()
+	defined, ok := p.roles[role]
+	p.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	for _, granted := range defined.Permissions {
+		if grants(granted, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionsOf returns every permission the role grants, expanded from
+// wildcards.
+func (p *Policy) PermissionsOf(role string) []string {
+	perms := []string{}
+	for _, perm := range Permissions {
+		if p.Allows(role, perm) {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+// Role returns the definition of a role.
+func (p *Policy) Role(name string) (models.Role, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	role, ok := p.roles[name]
+	return role, ok
+}
+
+// Roles returns every role, sorted by name.
+func (p *Policy) Roles() []models.Role {
+	p.mu.RLock()
+	roles := make([]models.Role, 0, len(p.roles))
+	for _, role := range p.roles {
+		roles = append(roles, role)
+	}
+	p.mu.RUnlock()
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// ================= ONE-TIME SECRETS =================
+
+// GenerateSecret returns a random URL-safe token and its hash. Only the hash
+// is stored, so a database leak does not reveal usable tokens.
+func GenerateSecret() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashSecret(token), nil
+}
+
+// HashSecret returns the SHA-256 hex digest of a token from GenerateSecret.
+// Tokens carry 256 bits of entropy, so a fast unsalted hash is enough.
+func HashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ================= API KEYS =================
+
+// APIKeyPrefix starts every API key, so that keys are recognisable in
+// headers and by secret scanners.
+const APIKeyPrefix = "ms_"
+
+// GenerateAPIKey returns a new API key and its hash.
+func GenerateAPIKey() (key, hash string, err error) {
+	token, _, err := GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + token
+	return key, HashSecret(key), nil
+}
+
+// IsAPIKey reports whether a bearer credential is an API key rather than a
+// JWT.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// ================= SENTIMENT CLASSIFIERS =================
+
+// SentimentClassifier picks the label that best describes a review.
+type SentimentClassifier interface {
+	// Name identifies the classifier, e.g. "openai:gpt-4o-mini".
+	Name() string
+	// Classify returns the label for review, which must be one of labels,
+	// ordered from best to worst.
+	Classify(ctx context.Context, review string, labels []string) (string, error)
+}
+
+const (
+	defaultSentimentTimeout  = 30 * time.Second
+	defaultSentimentAttempts = 3
+)
+
+// SentimentTimeout is how long one model call may take, from
+// SENTIMENT_TIMEOUT.
+func SentimentTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SENTIMENT_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultSentimentTimeout
+}
+
+// NewSentimentClassifierFromEnv returns the classifier selected by
+// SENTIMENT_PROVIDER: "openai" (any OpenAI-compatible endpoint), "ollama",
+// "lexicon" or "fake". Without it, OpenAI is used when OPENAI_API_KEY is set
+// and the lexicon otherwise. Model-backed classifiers fall back to the
+// lexicon when they fail, unless SENTIMENT_FALLBACK is "none".
+func NewSentimentClassifierFromEnv() (SentimentClassifier, error) {
+	provider := os.Getenv("SENTIMENT_PROVIDER")
+	if provider == "" {
+		provider = "lexicon"
+		if os.Getenv("OPENAI_API_KEY") != "" {
+			provider = "openai"
+		}
+	}
+
+	var primary SentimentClassifier
+	switch provider {
+	case "lexicon":
+		return LexiconClassifier{}, nil
+	case "fake":
+		return &FakeClassifier{Answer: os.Getenv("SENTIMENT_FAKE_LABEL")}, nil
+	case "openai":
+		token := os.Getenv("OPENAI_API_KEY")
+		if token == "" {
+			return nil, errors.New("OPENAI_API_KEY is required when SENTIMENT_PROVIDER=openai")
+		}
+		model := os.Getenv("OPENAI_MODEL")
+		opts := []openai.Option{openai.WithToken(token), openai.WithResponseFormat(openAIRankingFormat)}
+		if model != "" {
+			opts = append(opts, openai.WithModel(model))
+		} else {
+			model = "default"
+		}
+		if base := os.Getenv("OPENAI_BASE_URL"); base != "" {
+			opts = append(opts, openai.WithBaseURL(base))
+		}
+		llm, err := openai.New(opts...)
+		if err != nil {
+			return nil, err
+		}
+		primary = &LLMClassifier{Label: "openai:" + model, Model: llm, Timeout: SentimentTimeout(), MaxAttempts: SentimentMaxAttempts()}
+	case "ollama":
+		model := os.Getenv("OLLAMA_MODEL")
+		if model == "" {
+			model = "llama3.1"
+		}
+		opts := []ollama.Option{ollama.WithModel(model)}
+		if url := os.Getenv("OLLAMA_URL"); url != "" {
+			opts = append(opts, ollama.WithServerURL(url))
+		}
+		llm, err := ollama.New(opts...)
+		if err != nil {
+			return nil, err
+		}
+		primary = &LLMClassifier{
+			Label:       "ollama:" + model,
+			Model:       llm,
+			Timeout:     SentimentTimeout(),
+			MaxAttempts: SentimentMaxAttempts(),
+			CallOptions: []llms.CallOption{llms.WithJSONMode()},
+		}
+	default:
+		return nil, fmt.Errorf("unknown SENTIMENT_PROVIDER %q (use openai, ollama, lexicon or fake)", provider)
+	}
+
+	switch fallback := os.Getenv("SENTIMENT_FALLBACK"); fallback {
+	case "", "lexicon":
+		return &FallbackClassifier{Primary: primary, Secondary: LexiconClassifier{}}, nil
+	case "none":
+		return primary, nil
+	default:
+		return nil, fmt.Errorf("unknown SENTIMENT_FALLBACK %q (use lexicon or none)", fallback)
+	}
+}
+
+// ClassifyReview runs classifier and also returns the name of the classifier
+// that produced the label, which differs from classifier.Name() when a
+// FallbackClassifier had to fall back.
+func ClassifyReview(ctx context.Context, classifier SentimentClassifier, review string, labels []string) (string, string, error) {
+	if fc, ok := classifier.(*FallbackClassifier); ok {
+		return fc.classify(ctx, review, labels)
+	}
+	label, err := classifier.Classify(ctx, review, labels)
+	return label, classifier.Name(), err
+}
+
+// LLMClassifier asks a language model to classify the review. The model is
+// asked for a JSON object naming the ranking; answers that MatchRanking
+// cannot place are retried up to MaxAttempts times in total.
+type LLMClassifier struct {
+	Label       string
+	Model       llms.Model
+	Timeout     time.Duration
+	MaxAttempts int
+	// CallOptions are passed on every call, e.g. llms.WithJSONMode().
+	CallOptions []llms.CallOption
+}
+
+func (l *LLMClassifier) Name() string { return l.Label }
+
+func (l *LLMClassifier) Classify(ctx context.Context, review string, labels []string) (string, error) {
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+
+	attempts := max(l.MaxAttempts, 1)
+	opts := append([]llms.CallOption{llms.WithTemperature(0)}, l.CallOptions...)
+	prompt := rankingPrompt(review, labels)
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		response, err := llms.GenerateFromSinglePrompt(ctx, l.Model, prompt, opts...)
+		if err != nil {
+			return "", err
+		}
+		label, err := MatchRanking(response, labels)
+		if err == nil {
+			return label, nil
+		}
+		lastErr = err
+		prompt = rankingPrompt(review, labels) + fmt.Sprintf(
+			"\n\nYour previous answer was %q, which is not valid. Reply with only the JSON object.",
+			truncate(response, 200))
+	}
+	return "", fmt.Errorf("no valid ranking after %d attempts: %w", attempts, lastErr)
+}
+
+func rankingPrompt(review string, labels []string) string {
+	return "Classify the sentiment of this movie review as exactly one of: " +
+		strings.Join(labels, ", ") + ".\n" +
+		`Respond with only a JSON object of the form {"ranking": "<one of the options>"}.` +
+		"\n\nReview: " + review
+}
+
+// openAIRankingFormat asks OpenAI models for structured output matching
+// {"ranking": string}. The allowed names come from the database, so they are
+// listed in the prompt rather than in the schema.
+var openAIRankingFormat = &openai.ResponseFormat{
+	Type: "json_schema",
+	JSONSchema: &openai.ResponseFormatJSONSchema{
+		Name:   "review_ranking",
+		Strict: true,
+		Schema: &openai.ResponseFormatJSONSchemaProperty{
+			Type: "object",
+			Properties: map[string]*openai.ResponseFormatJSONSchemaProperty{
+				"ranking": {Type: "string", Description: "One of the rankings listed in the prompt"},
+			},
+			Required: []string{"ranking"},
+		},
+	},
+}
+
+// SentimentMaxAttempts is how many times a model may answer before the
+// classification fails, from SENTIMENT_MAX_ATTEMPTS.
+func SentimentMaxAttempts() int {
+	if n, err := strconv.Atoi(os.Getenv("SENTIMENT_MAX_ATTEMPTS")); err == nil && n >= 1 && n <= 10 {
+		return n
+	}
+	return defaultSentimentAttempts
+}
+
+// FakeClassifier answers without any model, for tests and offline
+// development. It returns Answer when set, and otherwise a label chosen by
+// hashing the review, so the same review always gets the same label.
+type FakeClassifier struct {
+	Answer string
+}
+
+func (f *FakeClassifier) Name() string { return "fake" }
+
+func (f *FakeClassifier) Classify(ctx context.Context, review string, labels []string) (string, error) {
+	if f.Answer != "" {
+		return f.Answer, nil
+	}
+	if len(labels) == 0 {
+		return "", errors.New("no labels to choose from")
+	}
+	h := fnv.New32a()
+	h.Write([]byte(review))
+	return labels[h.Sum32()%uint32(len(labels))], nil
+}
+
+// FallbackClassifier asks Primary first and Secondary when Primary fails or
+// times out.
+type FallbackClassifier struct {
+	Primary   SentimentClassifier
+	Secondary SentimentClassifier
+}
+
+func (f *FallbackClassifier) Name() string { return f.Primary.Name() }
+
+func (f *FallbackClassifier) Classify(ctx context.Context, review string, labels []string) (string, error) {
+	label, _, err := f.classify(ctx, review, labels)
+	return label, err
+}
+
+func (f *FallbackClassifier) classify(ctx context.Context, review string, labels []string) (string, string, error) {
+	label, err := f.Primary.Classify(ctx, review, labels)
+	if err == nil {
+		return label, f.Primary.Name(), nil
+	}
+	// Nobody is waiting for an answer any more
+	if ctx.Err() != nil {
+		return "", f.Primary.Name(), err
+	}
+	log.Printf("Sentiment classifier %s failed, falling back to %s: %v", f.Primary.Name(), f.Secondary.Name(), err)
+	label, err = f.Secondary.Classify(ctx, review, labels)
+	return label, f.Secondary.Name(), err
+}
@@ -9,58 +9,154 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// ================= JWT SECRETS =================
-var accessSecret = []byte(os.Getenv("JWT_SECRET"))
-var refreshSecret = []byte(os.Getenv("JWT_REFRESH_SECRET"))
+// ================= SIGNING KEYS =================
+// keyring signs and verifies every token; set it with UseKeyring at startup.
+var keyring *Keyring
+
+// UseKeyring makes k the keyring used by GenerateTokens and token validation.
+func UseKeyring(k *Keyring) {
+	keyring = k
+}
+
+// Token types, stored in the token_use claim so that a refresh token cannot
+// be used as an access token or the other way round.
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+	// TokenUseMFA marks the short-lived challenge token that stands between
+	// the password check and the second factor.
+	TokenUseMFA = "mfa"
+)
+
+// ================= TOKEN LIFETIMES =================
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+	MFATokenTTL     = 5 * time.Minute
+)
 
 // ================= CLAIMS STRUCT =================
+// Every token carries a unique jti (RegisteredClaims.ID) and its issue time,
+// which the access-token denylist matches against.
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID    string `json:"user_id"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
+	TokenUse  string `json:"token_use"`
+	// MFA is set when the session was opened with a second factor.
+	MFA bool `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// TokenPair is the result of GenerateTokens. RefreshID is the jti of the
+// refresh token, which the session store keeps to detect replayed tokens.
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshID        string
+	RefreshExpiresAt time.Time
+}
+
 // ================= GENERATE TOKENS =================
-func GenerateTokens(userID, role string) (string, string, error) {
+func GenerateTokens(userID, role, sessionID string, mfa bool) (*TokenPair, error) {
+	if keyring == nil {
+		return nil, errors.New("signing keys not initialised")
+	}
+
+	now := time.Now()
+	pair := &TokenPair{
+		RefreshID:        GenerateID(),
+		RefreshExpiresAt: now.Add(RefreshTokenTTL),
+	}
+
 	accessClaims := Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		TokenUse:  TokenUseAccess,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ID:        GenerateID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
 		},
 	}
 
 	refreshClaims := Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		TokenUse:  TokenUseRefresh,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ID:        pair.RefreshID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(pair.RefreshExpiresAt),
 		},
 	}
 
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims).
-		SignedString(accessSecret)
+	var err error
+	pair.AccessToken, err = keyring.sign(accessClaims)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).
-		SignedString(refreshSecret)
+	pair.RefreshToken, err = keyring.sign(refreshClaims)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return accessToken, refreshToken, nil
+	return pair, nil
+}
+
+// GenerateMFAToken returns a challenge token proving that the user passed
+// the password check. It is exchanged, together with a second factor, for
+// a token pair.
+func GenerateMFAToken(userID, role string) (string, error) {
+	if keyring == nil {
+		return "", errors.New("signing keys not initialised")
+	}
+
+	now := time.Now()
+	return keyring.sign(Claims{
+		UserID:   userID,
+		Role:     role,
+		TokenUse: TokenUseMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        GenerateID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFATokenTTL)),
+		},
+	})
 }
 
 // ================= VALIDATE TOKEN =================
-func ValidateToken(tokenStr string, secret []byte) (*Claims, error) {
+
+// ValidateAccessToken verifies an access token and returns its claims.
+func ValidateAccessToken(tokenStr string) (*Claims, error) {
+	return validateToken(tokenStr, TokenUseAccess)
+}
+
+// ValidateRefreshToken verifies a refresh token and returns its claims.
+func ValidateRefreshToken(tokenStr string) (*Claims, error) {
+	return validateToken(tokenStr, TokenUseRefresh)
+}
+
+// ValidateMFAToken verifies an MFA challenge token and returns its claims.
+func ValidateMFAToken(tokenStr string) (*Claims, error) {
+	return validateToken(tokenStr, TokenUseMFA)
+}
+
+func validateToken(tokenStr, use string) (*Claims, error) {
+	if keyring == nil {
+		return nil, errors.New("signing keys not initialised")
+	}
+
 	token, err := jwt.ParseWithClaims(
 		tokenStr,
 		&Claims{},
-		func(t *jwt.Token) (interface{}, error) {
-			return secret, nil
-		},
+		keyring.verificationKey,
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
 	)
 
 	if err != nil {
@@ -68,7 +164,7 @@ func ValidateToken(tokenStr string, secret []byte) (*Claims, error) {
 	}
 
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.TokenUse != use {
 		return nil, errors.New("invalid token")
 	}
 
@@ -97,6 +193,21 @@ func GetUserIdFromContext(c *gin.Context) (string, error) {
 	return uid, nil
 }
 
+// GetSessionIdFromContext returns the session ID stored in Gin context
+func GetSessionIdFromContext(c *gin.Context) (string, error) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		return "", errors.New("session_id not found in context")
+	}
+
+	sid, ok := sessionID.(string)
+	if !ok || sid == "" {
+		return "", errors.New("session_id in context has invalid type")
+	}
+
+	return sid, nil
+}
+
 // GetRoleFromContext returns the role stored in Gin context
 func GetRoleFromContext(c *gin.Context) (string, error) {
 	role, exists := c.Get("role")
@@ -111,3 +222,20 @@ func GetRoleFromContext(c *gin.Context) (string, error) {
 
 	return r, nil
 }
+
+// GetMFAFromContext reports whether the request's token was issued after a
+// second factor was checked.
+func GetMFAFromContext(c *gin.Context) bool {
+	return c.GetBool("mfa")
+}
+
+// GetAPIKeyScopesFromContext returns the scopes of the API key that
+// authenticated the request, and false when it used an access token.
+func GetAPIKeyScopesFromContext(c *gin.Context) ([]string, bool) {
+	scopes, ok := c.Get("api_key_scopes")
+	if !ok {
+		return nil, false
+	}
+	s, _ := scopes.([]string)
+	return s, true
+}